@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sphireco/mantis"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// accessLogEntry A single structured access log line
+type accessLogEntry struct {
+	Time      string  `json:"time"`
+	RequestID string  `json:"request_id"`
+	Method    string  `json:"method"`
+	Route     string  `json:"route"`
+	URI       string  `json:"uri"`
+	Status    int     `json:"status"`
+	Bytes     int     `json:"bytes"`
+	LatencyMS float64 `json:"latency_ms"`
+	Cache     string  `json:"cache,omitempty"`
+	ClientIP  string  `json:"client_ip"`
+}
+
+// accessLogger Writes JSON lines to a file, rotating it once it reaches maxSize
+type accessLogger struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	size       int64
+	maxSize    int64
+	maxBackups int
+	sampleRate float64
+}
+
+// newAccessLogger Open (or create) path for appending
+func newAccessLogger(path string, maxSizeMB int, maxBackups int, sampleRate float64) (*accessLogger, error) {
+	a := &accessLogger{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+		sampleRate: sampleRate,
+	}
+	return a, a.open()
+}
+
+// open Open the log file and record its current size
+func (a *accessLogger) open() error {
+	file, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	a.file = file
+	a.size = info.Size()
+	return nil
+}
+
+// sampled Errors are always logged, everything else according to sampleRate
+func (a *accessLogger) sampled(status int) bool {
+	return status >= http.StatusInternalServerError || a.sampleRate >= 1 || rand.Float64() < a.sampleRate
+}
+
+// Write Append entry to the log, rotating first if it would exceed maxSize
+func (a *accessLogger) Write(entry accessLogEntry) {
+	if a == nil {
+		return
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		mantis.HandleError("accessLogger:Marshal", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil || !a.sampled(entry.Status) {
+		return
+	}
+	if a.maxSize > 0 && a.size+int64(len(line)) > a.maxSize {
+		mantis.HandleError("accessLogger:rotate", a.rotate())
+		if a.file == nil {
+			return
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	mantis.HandleError("accessLogger:Write", err)
+}
+
+// rotate Shift path.N to path.N+1, move path to path.1 and reopen path
+func (a *accessLogger) rotate() error {
+	if a.file != nil {
+		a.file.Close()
+		a.file = nil
+	}
+
+	if a.maxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", a.path, a.maxBackups))
+		for i := a.maxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", a.path, i), fmt.Sprintf("%s.%d", a.path, i+1))
+		}
+		if err := os.Rename(a.path, a.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Truncate(a.path, 0); err != nil {
+		return err
+	}
+
+	return a.open()
+}
+
+// setSampleRate Change the fraction of successful requests that are logged
+func (a *accessLogger) setSampleRate(rate float64) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sampleRate = rate
+}
+
+// Close Close the underlying file
+func (a *accessLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// responseRecorder Captures the status code and number of bytes written
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+// WriteHeader Record the status before passing it on
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write Record the number of bytes written
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+// Unwrap The underlying writer, so http.ResponseController can flush through us
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// cacheStatus Set by cacheLookup when a request reaches http-cache and by cacheMiss
+// when it makes it past
+type cacheStatus struct {
+	cached bool
+	miss   bool
+}
+
+// result "hit" or "miss", or empty for a route without a cache
+func (s *cacheStatus) result() string {
+	switch {
+	case !s.cached:
+		return ""
+	case s.miss:
+		return "miss"
+	}
+	return "hit"
+}
+
+const cacheStatusKey contextKey = "cacheStatus"
+
+// cacheLookup Middleware placed around http-cache, so only routes with a cache count
+// hits and misses
+func cacheLookup(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := r.Context().Value(cacheStatusKey).(*cacheStatus); ok {
+			status.cached = true
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cacheMiss Middleware placed inside http-cache; reaching it means the cache missed
+func cacheMiss(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status, ok := r.Context().Value(cacheStatusKey).(*cacheStatus); ok {
+			status.miss = true
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP The first X-Forwarded-For address, falling back to the remote address
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
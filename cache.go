@@ -4,21 +4,48 @@ import (
 	"github.com/sphireco/mantis"
 	"github.com/victorspringer/http-cache"
 	"github.com/victorspringer/http-cache/adapter/memory"
+	"net/http"
 	"time"
 )
 
 // startCache Start our in memory LRU cache
 func (R *Router) startCache() {
+	client, err := newCacheClient(App.Server.MemCacheTime)
+	mantis.HandleFatalError(err)
+	R.httpCache.Store(client)
+}
+
+// newCacheClient Create an empty http-cache client whose entries live for ttl
+func newCacheClient(ttl time.Duration) (*cache.Client, error) {
 	memoryCache, err := memory.NewAdapter(
 		memory.AdapterWithAlgorithm(memory.LRU),
 		memory.AdapterWithCapacity(10000000),
 	)
-	mantis.HandleFatalError(err)
+	if err != nil {
+		return nil, err
+	}
 
-	R.httpCache, err = cache.NewClient(
+	return cache.NewClient(
 		cache.ClientWithAdapter(memoryCache),
-		cache.ClientWithTTL(App.Server.MemCacheTime*time.Minute),
+		cache.ClientWithTTL(ttl),
 		cache.ClientWithRefreshKey("opn"),
 	)
-	mantis.HandleFatalError(err)
+}
+
+// setCacheTTL Swap in a new, empty cache whose entries live for ttl
+func (R *Router) setCacheTTL(ttl time.Duration) error {
+	client, err := newCacheClient(ttl)
+	if err != nil {
+		return err
+	}
+	R.httpCache.Store(client)
+	return nil
+}
+
+// cacheMiddleware Wraps next with whichever http-cache client is current, so the
+// cache can be replaced on reload without rebuilding the routes
+func (R *Router) cacheMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		R.httpCache.Load().(*cache.Client).Middleware(next).ServeHTTP(w, r)
+	})
 }
@@ -0,0 +1,215 @@
+// Package client A typed client for the NBC API. Responses are decoded into the
+// same model types the server renders
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jsanc623/NBC/model"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every request
+const (
+	requestIDHeader = "X-Request-Id"
+	apiKeyHeader    = "X-Api-Key"
+)
+
+// Client Calls the NBC API at BaseURL. The zero value is not usable; use New
+type Client struct {
+	BaseURL    *url.URL
+	APIKey     string
+	HTTPClient *http.Client
+	// Retries The number of times a request is retried after a network error,
+	// a 429 or a 5xx response
+	Retries int
+	// RetryWait The wait before the first retry, doubled for each retry after it
+	RetryWait time.Duration
+	// PerPage The page size iterators request
+	PerPage int
+}
+
+// Option Configures a Client
+type Option func(*Client)
+
+// WithAPIKey Send key in the X-Api-Key header
+func WithAPIKey(key string) Option {
+	return func(c *Client) { c.APIKey = key }
+}
+
+// WithHTTPClient Make requests with httpClient instead of a default client
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.HTTPClient = httpClient }
+}
+
+// WithRetries Retry failed requests up to retries times, waiting wait before the first
+func WithRetries(retries int, wait time.Duration) Option {
+	return func(c *Client) { c.Retries, c.RetryWait = retries, wait }
+}
+
+// WithPerPage Request pages of perPage items when iterating
+func WithPerPage(perPage int) Option {
+	return func(c *Client) { c.PerPage = perPage }
+}
+
+// New A client for the API at baseURL, e.g. http://127.0.0.1:4000
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be absolute", baseURL)
+	}
+
+	c := &Client{
+		BaseURL:    u,
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		Retries:    2,
+		RetryWait:  200 * time.Millisecond,
+		PerPage:    20,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+type contextKey string
+
+const requestIDKey contextKey = "requestID"
+
+// WithRequestID Send id as the X-Request-Id of requests made with ctx, so a client's
+// calls can be correlated with its own logs. Without it each call gets a new ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// ListStations Iterates over all stations
+func (c *Client) ListStations(ctx context.Context) *Iterator[model.ShortStation] {
+	return newIterator[model.ShortStation](ctx, c, "/v1/stations")
+}
+
+// InService Iterates over the stations that are in service
+func (c *Client) InService(ctx context.Context) *Iterator[model.ShortStation] {
+	return newIterator[model.ShortStation](ctx, c, "/v1/stations/in-service")
+}
+
+// NotInService Iterates over the stations that are not in service
+func (c *Client) NotInService(ctx context.Context) *Iterator[model.ShortStation] {
+	return newIterator[model.ShortStation](ctx, c, "/v1/stations/not-in-service")
+}
+
+// Search Iterates over the stations whose name or address contains search
+func (c *Client) Search(ctx context.Context, search string) *Iterator[model.ShortStation] {
+	return newIterator[model.ShortStation](ctx, c, "/v1/stations/"+url.PathEscape(search))
+}
+
+// Dockable Whether bikesToReturn bikes can be docked at stationID. A station without
+// enough docks is reported in the result; an unknown station is an IsNotFound error
+func (c *Client) Dockable(ctx context.Context, stationID, bikesToReturn int) (*model.BikesToReturn, error) {
+	var result model.BikesToReturn
+	path := fmt.Sprintf("/v1/dockable/%d/%d", stationID, bikesToReturn)
+	if _, err := c.get(ctx, path, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Near The stations within radius meters of latitude and longitude, nearest first,
+// with their Distance set. A radius of 0 uses the server default
+func (c *Client) Near(ctx context.Context, latitude, longitude, radius float64) ([]model.StationDetail, error) {
+	query := url.Values{}
+	query.Set("lat", strconv.FormatFloat(latitude, 'f', -1, 64))
+	query.Set("lon", strconv.FormatFloat(longitude, 'f', -1, 64))
+	if radius > 0 {
+		query.Set("radius", strconv.FormatFloat(radius, 'f', -1, 64))
+	}
+
+	return newIterator[model.StationDetail](ctx, c, "/v2/stations/near?"+query.Encode()).All()
+}
+
+// get GET ref, an escaped path and query relative to BaseURL, and decode the JSON
+// response into out, retrying network errors, 429s and 5xx responses with
+// exponential backoff. The response headers are returned
+func (c *Client) get(ctx context.Context, ref string, out interface{}) (http.Header, error) {
+	u, err := url.Parse(c.BaseURL.String() + ref)
+	if err != nil {
+		return nil, err
+	}
+
+	id, _ := ctx.Value(requestIDKey).(string)
+	if id == "" {
+		id = newRequestID()
+	}
+
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			wait := time.Duration(float64(c.RetryWait) * math.Pow(2, float64(attempt-1)))
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+		}
+
+		var retry bool
+		var header http.Header
+		header, retry, err = c.do(ctx, u.String(), id, out)
+		if !retry {
+			return header, err
+		}
+	}
+	return nil, err
+}
+
+// do Make one request, reporting whether a failure is worth retrying
+func (c *Client) do(ctx context.Context, u, id string, out interface{}) (http.Header, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(requestIDHeader, id)
+	if c.APIKey != "" {
+		req.Header.Set(apiKeyHeader, c.APIKey)
+	}
+
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, ctx.Err() == nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		apiErr := newError(res, body, id)
+		return res.Header, res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, apiErr
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return res.Header, false, &Error{StatusCode: res.StatusCode, Message: "invalid response: " + err.Error(), RequestID: id, Body: body}
+	}
+	return res.Header, false, nil
+}
+
+// newRequestID A random 16 byte hex ID, the same shape the server generates
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Error A non-2xx response from the API, decoded from its application/problem+json body
+type Error struct {
+	StatusCode int
+	// Type The problem type URI, e.g. urn:nbc:problem:station-not-found
+	Type string
+	// Message The problem detail, or its title when there is no detail
+	Message string
+	// RequestID The X-Request-Id of the failed request, for finding it in server logs
+	RequestID string
+	// Body The raw response body
+	Body []byte
+}
+
+// Error Implements error
+func (e *Error) Error() string {
+	return fmt.Sprintf("nbc: %d %s (request %s)", e.StatusCode, e.Message, e.RequestID)
+}
+
+// IsNotFound True if err is an API 404, such as an unknown station
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsBadRequest True if err is an API 400, such as an invalid parameter
+func IsBadRequest(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.StatusCode == http.StatusBadRequest
+}
+
+// problem The RFC 7807 body of error responses
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Detail    string `json:"detail"`
+	RequestID string `json:"requestId"`
+}
+
+// newError The Error for res, from its problem body where it has one
+func newError(res *http.Response, body []byte, id string) *Error {
+	if responseID := res.Header.Get(requestIDHeader); responseID != "" {
+		id = responseID
+	}
+	apiErr := &Error{StatusCode: res.StatusCode, Message: http.StatusText(res.StatusCode), RequestID: id, Body: body}
+
+	var p problem
+	if json.Unmarshal(body, &p) == nil {
+		apiErr.Type = p.Type
+		if p.Title != "" {
+			apiErr.Message = p.Title
+		}
+		if strings.TrimSpace(p.Detail) != "" {
+			apiErr.Message = p.Detail
+		}
+		if p.RequestID != "" {
+			apiErr.RequestID = p.RequestID
+		}
+	}
+	return apiErr
+}
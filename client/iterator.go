@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Iterator Walks a paged listing one item at a time, following the Link rel="next"
+// of each page. Pages are fetched as needed
+//
+//	stations := c.ListStations(ctx)
+//	for stations.Next() {
+//		fmt.Println(stations.Value().StationName)
+//	}
+//	if err := stations.Err(); err != nil {
+//		...
+//	}
+type Iterator[T any] struct {
+	ctx    context.Context
+	client *Client
+
+	next    string
+	items   []T
+	current T
+	total   int
+	err     error
+}
+
+// newIterator An iterator over the listing at ref, a path and optional query
+func newIterator[T any](ctx context.Context, c *Client, ref string) *Iterator[T] {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return &Iterator[T]{err: err}
+	}
+	query := u.Query()
+	query.Set("page", "1")
+	query.Set("perPage", strconv.Itoa(c.PerPage))
+	u.RawQuery = query.Encode()
+
+	return &Iterator[T]{ctx: ctx, client: c, next: u.String(), total: -1}
+}
+
+// Next Advance to the next item, false once the listing is exhausted or a request fails
+func (it *Iterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.next == "" || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+
+	it.current, it.items = it.items[0], it.items[1:]
+	return true
+}
+
+// Value The current item
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+// Err The error that stopped iteration, if any
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// Total The number of items in the listing, or -1 before the first page is fetched
+func (it *Iterator[T]) Total() int {
+	return it.total
+}
+
+// All Collect every remaining item
+func (it *Iterator[T]) All() ([]T, error) {
+	items := make([]T, 0)
+	for it.Next() {
+		items = append(items, it.Value())
+	}
+	return items, it.Err()
+}
+
+// fetch Load the next page. v1 listings are bare arrays and v2 listings are pages
+// with a stations array
+func (it *Iterator[T]) fetch() {
+	var body json.RawMessage
+	header, err := it.client.get(it.ctx, it.next, &body)
+	if err != nil {
+		it.err = err
+		return
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+		it.err = json.Unmarshal(body, &it.items)
+	} else {
+		var page struct {
+			Stations []T `json:"stations"`
+		}
+		it.err = json.Unmarshal(body, &page)
+		it.items = page.Stations
+	}
+
+	if total, err := strconv.Atoi(header.Get("X-Total-Count")); err == nil {
+		it.total = total
+	}
+	it.next = nextLink(header.Get("Link"))
+}
+
+// linkPattern One <uri>; rel="name" entry of a Link header
+var linkPattern = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="?([^",]*)"?`)
+
+// nextLink The rel="next" URI of an RFC 5988 Link header, or an empty string
+func nextLink(header string) string {
+	for _, match := range linkPattern.FindAllStringSubmatch(header, -1) {
+		if match[2] == "next" {
+			return match[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"compress/gzip"
+	"github.com/andybalholm/brotli"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressibleStatus Reports whether responses with status carry a body worth encoding
+func compressibleStatus(status int) bool {
+	return status >= http.StatusOK && status != http.StatusNoContent &&
+		status != http.StatusPartialContent && status != http.StatusNotModified
+}
+
+// acceptedEncoding The content coding to use for a client sending header as its
+// Accept-Encoding: br, then gzip, or "" for none
+func acceptedEncoding(header string) string {
+	quality := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			if value := strings.TrimSpace(param); strings.HasPrefix(value, "q=") {
+				if parsed, err := strconv.ParseFloat(value[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		quality[coding] = q
+	}
+
+	for _, coding := range []string{"br", "gzip"} {
+		q, ok := quality[coding]
+		if !ok {
+			q, ok = quality["*"]
+		}
+		if ok && q > 0 {
+			return coding
+		}
+	}
+	return ""
+}
+
+// compress Middleware which encodes responses of at least SRV_COMPRESS_MIN_SIZE bytes
+// with brotli or gzip, as negotiated from Accept-Encoding. It sits outside http-cache,
+// which stores and replays the unencoded bodies, so a cached response is encoded for
+// each client as it asks
+func compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := currentConfig().Server
+		if !cfg.Compression {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: w, encoding: encoding, minSize: cfg.CompressMinSize, status: http.StatusOK}
+		defer writer.close()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// compressWriter Buffers the start of a response until it is known to be at least
+// minSize bytes, then encodes it; shorter responses are written as they are
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	minSize     int
+	status      int
+	wroteHeader bool
+	started     bool
+	buffer      []byte
+	encoder     io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	if !compressibleStatus(status) {
+		w.start(false)
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	if w.started {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buffer = append(w.buffer, b...)
+	if len(w.buffer) >= w.minSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// start Write the header, encoded if encode is set and the response allows it, and
+// anything buffered so far
+func (w *compressWriter) start(encode bool) error {
+	w.started = true
+	header := w.Header()
+	contentType := header.Get("Content-Type")
+	if encode && compressibleStatus(w.status) && header.Get("Content-Encoding") == "" &&
+		!strings.HasPrefix(contentType, "text/event-stream") {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		// The encoded bytes differ, but the representation is the same
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		switch w.encoding {
+		case "br":
+			w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+		default:
+			w.encoder = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if len(w.buffer) == 0 {
+		return nil
+	}
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(w.buffer)
+	} else {
+		_, err = w.ResponseWriter.Write(w.buffer)
+	}
+	w.buffer = nil
+	return err
+}
+
+// close Write out a response that never reached minSize and finish the encoding
+func (w *compressWriter) close() {
+	if !w.started && w.wroteHeader {
+		w.start(false)
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
+
+// Flush Send what has been written so far, encoded if the response is long enough
+func (w *compressWriter) Flush() {
+	if !w.started {
+		w.wroteHeader = true
+		w.start(len(w.buffer) >= w.minSize)
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap The underlying writer, so http.ResponseController can reach it through us
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
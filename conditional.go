@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snapshotInfo The snapshot a response was built from, recorded by getJSON
+type snapshotInfo struct {
+	version  uint64
+	loadedAt time.Time
+}
+
+const snapshotKey contextKey = "snapshot"
+
+// recordSnapshot Note the feed body a request's response is built from, if the
+// conditional middleware is watching the request in ctx
+func recordSnapshot(ctx context.Context, body []byte) {
+	snapshot, ok := ctx.Value(snapshotKey).(*snapshotInfo)
+	if !ok {
+		return
+	}
+	h := fnv.New64a()
+	h.Write(body)
+	snapshot.version = h.Sum64()
+	snapshot.loadedAt = feed.lastLoaded()
+}
+
+// setSnapshotHeaders Give a response built from the request's snapshot, in format, an
+// ETag and Last-Modified. They are set inside http-cache, so a cached copy keeps the
+// validators of the snapshot it was built from
+func setSnapshotHeaders(w http.ResponseWriter, r *http.Request, format string) {
+	snapshot, ok := r.Context().Value(snapshotKey).(*snapshotInfo)
+	if !ok || snapshot.version == 0 {
+		return
+	}
+
+	tag := strconv.FormatUint(snapshot.version, 36)
+	if format != "" && format != jsonEncoder.Name {
+		tag += "-" + format
+	}
+	w.Header().Set("ETag", `"`+tag+`"`)
+	if !snapshot.loadedAt.IsZero() {
+		w.Header().Set("Last-Modified", snapshot.loadedAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// conditional Answers GET requests whose If-None-Match or If-Modified-Since match the
+// response with 304 Not Modified. Responses with a Last-Modified may be cached until
+// their snapshot is due to be refetched
+func conditional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		writer := &conditionalWriter{ResponseWriter: w, request: r}
+		next.ServeHTTP(writer, r.WithContext(context.WithValue(r.Context(), snapshotKey, &snapshotInfo{})))
+	})
+}
+
+// conditionalWriter Checks the request's validators against the response headers
+// once they are written, dropping the body of a 304
+type conditionalWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	wroteHeader bool
+	discard     bool
+}
+
+func (w *conditionalWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status == http.StatusOK {
+		header := w.Header()
+		if modified, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+			header.Set("Cache-Control", "public, max-age="+strconv.Itoa(freshFor(modified)))
+		}
+		if notModified(w.request, header) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			w.discard = true
+			status = http.StatusNotModified
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *conditionalWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.discard {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap The underlying writer, so http.ResponseController can flush through us
+func (w *conditionalWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// freshFor Seconds until a snapshot loaded at modified is due to be refetched
+func freshFor(modified time.Time) int {
+	remaining := currentConfig().Feed.RefreshInterval - time.Since(modified)
+	if remaining <= 0 {
+		return 0
+	}
+	return int(math.Floor(remaining.Seconds()))
+}
+
+// notModified Reports whether the validators of r match a response with header.
+// If-None-Match uses the weak comparison, so compressed variants match too, and
+// If-Modified-Since is only checked without it
+func notModified(r *http.Request, header http.Header) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		etag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
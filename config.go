@@ -0,0 +1,670 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/subosito/gotenv"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config The effective configuration. Each leaf field is tagged with its config
+// file key, environment variable and default; durations also accept a bare number
+// in the given unit, so SRV_WRITE_TIMEOUT=5 and SRV_WRITE_TIMEOUT=5s are equivalent.
+// Values are layered as defaults < config file < .env < environment < CLI flags.
+// Fields tagged live can be changed by a reload without restarting
+type Config struct {
+	App     AppConfig     `key:"app"`
+	Feed    FeedConfig    `key:"feed"`
+	Log     LogConfig     `key:"log"`
+	Server  ServerConfig  `key:"server"`
+	GRPC    GRPCConfig    `key:"grpc"`
+	GraphQL GraphQLConfig `key:"graphql"`
+	CORS    CORSConfig    `key:"cors"`
+	TLS     TLSConfig     `key:"tls"`
+	Trace   TraceConfig   `key:"trace"`
+	Redis   RedisConfig   `key:"redis"`
+
+	// sources Where each setting's value came from, by key
+	sources map[string]string
+
+	// file The config file that was read, if any
+	file string
+}
+
+// AppConfig Identifies the application
+type AppConfig struct {
+	Name    string `key:"name" env:"APP_NAME"`
+	ID      string `key:"id" env:"APP_ID"`
+	Version string `key:"version" env:"APP_VERSION"`
+}
+
+// FeedConfig The upstream CitiBike feed
+type FeedConfig struct {
+	URL             string        `key:"url" env:"FEED_URL" default:"https://www.citibikenyc.com/stations/json" live:"true"`
+	RefreshInterval time.Duration `key:"refresh_interval" env:"FEED_REFRESH_INTERVAL" default:"10m" unit:"s" live:"true"`
+}
+
+// LogConfig Log level, location, rotation and access log sampling
+type LogConfig struct {
+	Level            string  `key:"level" env:"LOG_LEVEL" default:"info" live:"true"`
+	Location         string  `key:"location" env:"LOG_LOCATION" default:"nbc.log"`
+	AccessLocation   string  `key:"access_location" env:"ACCESS_LOG_LOCATION" default:"nbc.access.log"`
+	MaxSizeMB        int     `key:"max_size_mb" env:"LOG_MAX_SIZE_MB" default:"100"`
+	MaxBackups       int     `key:"max_backups" env:"LOG_MAX_BACKUPS" default:"5"`
+	AccessSampleRate float64 `key:"access_sample_rate" env:"ACCESS_LOG_SAMPLE_RATE" default:"1" live:"true"`
+}
+
+// ServerConfig The HTTP server
+type ServerConfig struct {
+	Network         string        `key:"network" env:"SRV_NETWORK" default:"tcp"`
+	Address         string        `key:"address" env:"SRV_ADDRESS" default:"127.0.0.1"`
+	Port            string        `key:"port" env:"SRV_PORT" default:"4000"`
+	Listeners       string        `key:"listeners" env:"SRV_LISTENERS"`
+	WriteTimeout    time.Duration `key:"write_timeout" env:"SRV_WRITE_TIMEOUT" default:"30s" unit:"s"`
+	ReadTimeout     time.Duration `key:"read_timeout" env:"SRV_READ_TIMEOUT" default:"30s" unit:"s"`
+	MemCacheTime    time.Duration `key:"mem_cache_time" env:"SRV_MEMCACHE_TIME_MINUTES" default:"30m" unit:"m" live:"true"`
+	ShutdownTimeout time.Duration `key:"shutdown_timeout" env:"SRV_SHUTDOWN_TIMEOUT" default:"15s" unit:"s"`
+	RequestTimeout  time.Duration `key:"request_timeout" env:"SRV_REQUEST_TIMEOUT" default:"20s" unit:"s" live:"true"`
+	WatchConfig     bool          `key:"watch_config" env:"SRV_WATCH_CONFIG" default:"false"`
+	RoutesFile      string        `key:"routes_file" env:"SRV_ROUTES_FILE" default:"routes.json"`
+	MaxPerPage      int           `key:"max_per_page" env:"SRV_MAX_PER_PAGE" default:"100" live:"true"`
+	Compression     bool          `key:"compression" env:"SRV_COMPRESSION" default:"true" live:"true"`
+	CompressMinSize int           `key:"compress_min_size" env:"SRV_COMPRESS_MIN_SIZE" default:"1024" live:"true"`
+
+	UnversionedSunset string `key:"unversioned_sunset" env:"SRV_UNVERSIONED_SUNSET" default:"2027-06-30"`
+}
+
+// GRPCConfig The gRPC server, enabled when Port is set
+type GRPCConfig struct {
+	Address       string        `key:"address" env:"GRPC_ADDRESS" default:"127.0.0.1"`
+	Port          string        `key:"port" env:"GRPC_PORT" default:"4001"`
+	WatchInterval time.Duration `key:"watch_interval" env:"GRPC_WATCH_INTERVAL" default:"30s" unit:"s" live:"true"`
+	Reflection    bool          `key:"reflection" env:"GRPC_REFLECTION" default:"true"`
+}
+
+// GraphQLConfig Limits on /graphql operations, checked before they run, and how often
+// subscriptions check the snapshot for changes
+type GraphQLConfig struct {
+	MaxDepth      int           `key:"max_depth" env:"GRAPHQL_MAX_DEPTH" default:"6" live:"true"`
+	MaxComplexity int           `key:"max_complexity" env:"GRAPHQL_MAX_COMPLEXITY" default:"5000" live:"true"`
+	WatchInterval time.Duration `key:"watch_interval" env:"GRAPHQL_WATCH_INTERVAL" default:"30s" unit:"s" live:"true"`
+}
+
+// CORSConfig Cross-origin access from browsers. Origins are comma separated and may
+// use * wildcards, such as https://*.example.com; no origins disables CORS
+type CORSConfig struct {
+	AllowedOrigins   string        `key:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" live:"true"`
+	AllowedHeaders   string        `key:"allowed_headers" env:"CORS_ALLOWED_HEADERS" default:"Accept, Accept-Encoding, Authorization, Content-Type, If-Modified-Since, If-None-Match, Traceparent, X-Request-Id" live:"true"`
+	ExposedHeaders   string        `key:"exposed_headers" env:"CORS_EXPOSED_HEADERS" default:"Deprecation, ETag, Link, Sunset, X-App-Name, X-Request-Id, X-Total-Count" live:"true"`
+	AllowCredentials bool          `key:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS" default:"false" live:"true"`
+	MaxAge           time.Duration `key:"max_age" env:"CORS_MAX_AGE" default:"10m" unit:"s" live:"true"`
+}
+
+// TLSConfig HTTPS and HTTP/2 for the HTTP server, enabled when CertFile and KeyFile
+// are set; the files are reloaded when they change. With ClientCAFile, routes using the
+// adminOnly middleware require a client certificate it signed. RedirectPort, if set,
+// serves plain HTTP redirects to HTTPS
+type TLSConfig struct {
+	CertFile     string `key:"cert_file" env:"TLS_CERT_FILE"`
+	KeyFile      string `key:"key_file" env:"TLS_KEY_FILE"`
+	ClientCAFile string `key:"client_ca_file" env:"TLS_CLIENT_CA_FILE"`
+	MinVersion   string `key:"min_version" env:"TLS_MIN_VERSION" default:"1.2"`
+	RedirectPort string `key:"redirect_port" env:"TLS_REDIRECT_PORT"`
+}
+
+// enabled True when the HTTP server should serve HTTPS
+func (c TLSConfig) enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// TraceConfig OpenTelemetry export
+type TraceConfig struct {
+	Exporter    string  `key:"exporter" env:"TRACE_EXPORTER"`
+	SampleRatio float64 `key:"sample_ratio" env:"TRACE_SAMPLE_RATIO" default:"1"`
+}
+
+// RedisConfig The optional Redis client, enabled when Address is set
+type RedisConfig struct {
+	Network         string        `key:"network" env:"REDIS_NETWORK" default:"tcp"`
+	Address         string        `key:"address" env:"REDIS_ADDRESS"`
+	Password        string        `key:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB              int           `key:"db" env:"REDIS_DB" default:"0"`
+	MaxRetries      int           `key:"max_retries" env:"REDIS_MAX_RETRIES" default:"0"`
+	MinRetryBackoff time.Duration `key:"min_retry_backoff" env:"REDIS_MIN_RETRY_BACKOFF" default:"8ms" unit:"ms"`
+	MaxRetryBackoff time.Duration `key:"max_retry_backoff" env:"REDIS_MAX_RETRY_BACKOFF" default:"512ms" unit:"ms"`
+	DialTimeout     time.Duration `key:"dial_timeout" env:"REDIS_DIAL_TIMEOUT" default:"5s" unit:"s"`
+	ReadTimeout     time.Duration `key:"read_timeout" env:"REDIS_READ_TIMEOUT" default:"3s" unit:"s"`
+	WriteTimeout    time.Duration `key:"write_timeout" env:"REDIS_WRITE_TIMEOUT" default:"3s" unit:"s"`
+	PoolSize        int           `key:"pool_size" env:"REDIS_POOL_SIZE" default:"10"`
+	MinIdleConns    int           `key:"min_idle_conns" env:"REDIS_MIN_IDLE_CONNS" default:"0"`
+}
+
+// configFileEnv Names a YAML or TOML config file when -config isn't given
+const configFileEnv = "CONFIG_FILE"
+
+// dotEnvFile The .env file read from the working directory
+const dotEnvFile = ".env"
+
+// ConfigErrors Every problem found while loading configuration
+type ConfigErrors []string
+
+// Error Implements error, one problem per line
+func (e ConfigErrors) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e, "\n  ")
+}
+
+// setting A single leaf of Config
+type setting struct {
+	Key    string
+	Env    string
+	Flag   string
+	Secret bool
+	Live   bool
+	Source string
+
+	def   string
+	unit  time.Duration
+	value reflect.Value
+}
+
+// settings Walk Config, returning every leaf setting in declaration order
+func (c *Config) settings() []*setting {
+	var settings []*setting
+	root := reflect.ValueOf(c).Elem()
+
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i)
+		if section.Tag.Get("key") == "" {
+			continue
+		}
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			key := section.Tag.Get("key") + "." + field.Tag.Get("key")
+			s := &setting{
+				Key:    key,
+				Env:    field.Tag.Get("env"),
+				Flag:   strings.Replace(key, "_", "-", -1),
+				Secret: field.Tag.Get("secret") == "true",
+				Live:   field.Tag.Get("live") == "true",
+				def:    field.Tag.Get("default"),
+				value:  root.Field(i).Field(j),
+			}
+			if unit := field.Tag.Get("unit"); unit != "" {
+				s.unit, _ = time.ParseDuration("1" + unit)
+			}
+			settings = append(settings, s)
+		}
+	}
+
+	return settings
+}
+
+// set Parse raw into the setting according to its type
+func (s *setting) set(raw string, source string) error {
+	raw = strings.TrimSpace(raw)
+
+	switch s.value.Interface().(type) {
+	case string:
+		s.value.SetString(raw)
+	case int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", s.describe(source), raw)
+		}
+		s.value.SetInt(int64(n))
+	case float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a number", s.describe(source), raw)
+		}
+		s.value.SetFloat(f)
+	case bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a boolean", s.describe(source), raw)
+		}
+		s.value.SetBool(b)
+	case time.Duration:
+		d, err := parseDuration(raw, s.unit)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not a duration (e.g. \"5s\")", s.describe(source), raw)
+		}
+		s.value.SetInt(int64(d))
+	default:
+		return fmt.Errorf("%s: unsupported type %s", s.Key, s.value.Type())
+	}
+
+	s.Source = source
+	return nil
+}
+
+// String The current value, formatted as it would be written in config
+func (s *setting) String() string {
+	return fmt.Sprint(s.value.Interface())
+}
+
+// describe Name the setting in terms of the source it was read from
+func (s *setting) describe(source string) string {
+	switch source {
+	case "environment", dotEnvFile:
+		return fmt.Sprintf("%s (%s)", s.Env, source)
+	case "flag":
+		return "-" + s.Flag
+	}
+	return fmt.Sprintf("%s (%s)", s.Key, source)
+}
+
+// parseDuration Accept Go durations, or a bare number in unit
+func parseDuration(raw string, unit time.Duration) (time.Duration, error) {
+	if unit > 0 {
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(raw)
+}
+
+// loadConfig Build the effective configuration from every source. args are the
+// command line arguments without the program name; positional arguments (such
+// as "config print") are returned. All problems are reported together
+func loadConfig(args []string) (*Config, []string, error) {
+	cfg := &Config{}
+	settings := cfg.settings()
+	byKey := make(map[string]*setting)
+	byEnv := make(map[string]*setting)
+	var problems ConfigErrors
+
+	for _, s := range settings {
+		byKey[s.Key] = s
+		byEnv[s.Env] = s
+		if err := s.set(s.def, "default"); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	flags, configFile, positional, err := parseFlags(settings, args)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Config file
+	if configFile == "" {
+		configFile = os.Getenv(configFileEnv)
+	}
+	if configFile != "" {
+		values, err := readConfigFile(configFile)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		for _, key := range sortedKeys(values) {
+			s, ok := byKey[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown setting %q%s",
+					configFile, key, suggest(key, byKey)))
+				continue
+			}
+			if err := s.set(values[key], configFile); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+
+	// .env
+	dotEnv, err := gotenv.Read(dotEnvFile)
+	if err != nil && !os.IsNotExist(err) {
+		problems = append(problems, fmt.Sprintf("%s: %s", dotEnvFile, err))
+	}
+	for _, key := range sortedKeys(dotEnv) {
+		s, ok := byEnv[key]
+		if !ok {
+			if !strings.HasPrefix(key, "OTEL_") && key != configFileEnv {
+				problems = append(problems, fmt.Sprintf("%s: unknown setting %s%s", dotEnvFile, key, suggest(key, byEnv)))
+			}
+			continue
+		}
+		if err := s.set(dotEnv[key], dotEnvFile); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	// Environment
+	for _, s := range settings {
+		if raw, ok := os.LookupEnv(s.Env); ok {
+			if err := s.set(raw, "environment"); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+
+	// CLI flags
+	for _, s := range settings {
+		if raw, ok := flags[s.Flag]; ok {
+			if err := s.set(raw, "flag"); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, positional, problems
+	}
+
+	cfg.file = configFile
+	cfg.sources = make(map[string]string)
+	for _, s := range settings {
+		cfg.sources[s.Key] = s.Source
+	}
+
+	// Export the rest of .env for libraries that read the environment themselves;
+	// our own settings are left out so a reload still sees .env changes
+	for key, value := range dotEnv {
+		if _, ok := byEnv[key]; !ok && os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+
+	return cfg, positional, nil
+}
+
+// parseFlags Parse flags named after each setting's key (e.g. -server.write-timeout=5s)
+// wherever they appear in args, returning the raw values, -config and positional args
+func parseFlags(settings []*setting, args []string) (map[string]string, string, []string, error) {
+	values := make(map[string]string)
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	configFile := fs.String("config", "", "YAML or TOML config file")
+	for _, s := range settings {
+		fs.Var(flagValue{name: s.Flag, values: values}, s.Flag, fmt.Sprintf("%s (env %s)", s.Key, s.Env))
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, "", nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	return values, *configFile, positional, nil
+}
+
+// flagValue Records the raw flag value so it can be applied in layer order
+type flagValue struct {
+	name   string
+	values map[string]string
+}
+
+func (f flagValue) String() string {
+	return ""
+}
+
+func (f flagValue) Set(raw string) error {
+	f.values[f.name] = raw
+	return nil
+}
+
+// readConfigFile Read a YAML or TOML file into flat dotted keys
+func readConfigFile(path string) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var tree map[string]interface{}
+		if err := yaml.Unmarshal(contents, &tree); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		flatten("", tree, values)
+	case ".toml":
+		var tree map[string]interface{}
+		if err := toml.Unmarshal(contents, &tree); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		flatten("", tree, values)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file type, use .yaml, .yml or .toml", path)
+	}
+
+	return values, nil
+}
+
+// flatten Collapse nested maps into dotted keys
+func flatten(prefix string, tree interface{}, values map[string]string) {
+	switch node := tree.(type) {
+	case map[string]interface{}:
+		for k, v := range node {
+			flatten(joinKey(prefix, k), v, values)
+		}
+	case map[interface{}]interface{}:
+		for k, v := range node {
+			flatten(joinKey(prefix, fmt.Sprint(k)), v, values)
+		}
+	case nil:
+		values[prefix] = ""
+	default:
+		values[prefix] = fmt.Sprint(node)
+	}
+}
+
+func joinKey(prefix string, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// validate Check values that parsed but make no sense
+func (c *Config) validate() []string {
+	var problems []string
+
+	if _, err := url.ParseRequestURI(c.Feed.URL); err != nil {
+		problems = append(problems, fmt.Sprintf("feed.url (FEED_URL) %q is not a valid URL", c.Feed.URL))
+	}
+	if c.Feed.RefreshInterval <= 0 {
+		problems = append(problems, "feed.refresh_interval (FEED_REFRESH_INTERVAL) must be positive")
+	}
+	if _, ok := logLevels[c.Log.Level]; !ok {
+		problems = append(problems, fmt.Sprintf("log.level (LOG_LEVEL) %q must be debug, info or error", c.Log.Level))
+	}
+	if c.Log.Location == "" {
+		problems = append(problems, "log.location (LOG_LOCATION) must not be empty")
+	}
+	if c.Log.AccessLocation == "" || c.Log.AccessLocation == c.Log.Location {
+		problems = append(problems, "log.access_location (ACCESS_LOG_LOCATION) must be set, to a file other than log.location (LOG_LOCATION)")
+	}
+	if c.Log.MaxSizeMB < 0 {
+		problems = append(problems, "log.max_size_mb (LOG_MAX_SIZE_MB) must not be negative")
+	}
+	if c.Log.MaxBackups < 0 {
+		problems = append(problems, "log.max_backups (LOG_MAX_BACKUPS) must not be negative")
+	}
+	if c.Log.AccessSampleRate < 0 || c.Log.AccessSampleRate > 1 {
+		problems = append(problems, "log.access_sample_rate (ACCESS_LOG_SAMPLE_RATE) must be between 0 and 1")
+	}
+	if port, err := strconv.Atoi(c.Server.Port); c.Server.Network == "tcp" && (err != nil || port < 0 || port > 65535) {
+		problems = append(problems, fmt.Sprintf("server.port (SRV_PORT) %q is not a valid port", c.Server.Port))
+	}
+	if c.Server.Network != "tcp" && c.Server.Network != "unix" {
+		problems = append(problems, fmt.Sprintf("server.network (SRV_NETWORK) %q must be tcp or unix", c.Server.Network))
+	}
+	if _, err := c.Server.listeners(); err != nil {
+		problems = append(problems, fmt.Sprintf("server.listeners (SRV_LISTENERS) %s", err))
+	}
+	if port, err := strconv.Atoi(c.GRPC.Port); c.GRPC.Port != "" && (err != nil || port < 0 || port > 65535) {
+		problems = append(problems, fmt.Sprintf("grpc.port (GRPC_PORT) %q is not a valid port", c.GRPC.Port))
+	}
+	if c.GRPC.WatchInterval <= 0 {
+		problems = append(problems, "grpc.watch_interval (GRPC_WATCH_INTERVAL) must be positive")
+	}
+	if c.GraphQL.MaxDepth < 1 {
+		problems = append(problems, "graphql.max_depth (GRAPHQL_MAX_DEPTH) must be at least 1")
+	}
+	if c.GraphQL.MaxComplexity < 1 {
+		problems = append(problems, "graphql.max_complexity (GRAPHQL_MAX_COMPLEXITY) must be at least 1")
+	}
+	if c.GraphQL.WatchInterval <= 0 {
+		problems = append(problems, "graphql.watch_interval (GRAPHQL_WATCH_INTERVAL) must be positive")
+	}
+	if c.Server.MaxPerPage < 1 {
+		problems = append(problems, "server.max_per_page (SRV_MAX_PER_PAGE) must be at least 1")
+	}
+	for _, origin := range splitList(c.CORS.AllowedOrigins) {
+		if _, err := path.Match(origin, ""); err != nil || (origin != "*" && !strings.Contains(origin, "://")) {
+			problems = append(problems, fmt.Sprintf("cors.allowed_origins (CORS_ALLOWED_ORIGINS) %q must be * or a scheme://host pattern", origin))
+		} else if origin == "*" && c.CORS.AllowCredentials {
+			problems = append(problems, "cors.allow_credentials (CORS_ALLOW_CREDENTIALS) can't be used with the * origin")
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		problems = append(problems, "tls.cert_file (TLS_CERT_FILE) and tls.key_file (TLS_KEY_FILE) must be set together")
+	}
+	if !c.TLS.enabled() && (c.TLS.ClientCAFile != "" || c.TLS.RedirectPort != "") {
+		problems = append(problems, "tls.client_ca_file (TLS_CLIENT_CA_FILE) and tls.redirect_port (TLS_REDIRECT_PORT) require tls.cert_file and tls.key_file")
+	}
+	if _, ok := tlsVersions[c.TLS.MinVersion]; !ok {
+		problems = append(problems, fmt.Sprintf("tls.min_version (TLS_MIN_VERSION) %q must be 1.2 or 1.3", c.TLS.MinVersion))
+	}
+	if port, err := strconv.Atoi(c.TLS.RedirectPort); c.TLS.RedirectPort != "" && (err != nil || port < 0 || port > 65535) {
+		problems = append(problems, fmt.Sprintf("tls.redirect_port (TLS_REDIRECT_PORT) %q is not a valid port", c.TLS.RedirectPort))
+	}
+	if c.TLS.RedirectPort != "" && c.Server.Network != "tcp" {
+		problems = append(problems, "tls.redirect_port (TLS_REDIRECT_PORT) requires server.network (SRV_NETWORK) tcp")
+	}
+	if c.Server.RequestTimeout < 0 {
+		problems = append(problems, "server.request_timeout (SRV_REQUEST_TIMEOUT) must not be negative")
+	}
+	if c.Server.CompressMinSize < 0 {
+		problems = append(problems, "server.compress_min_size (SRV_COMPRESS_MIN_SIZE) must not be negative")
+	}
+	if _, err := time.Parse("2006-01-02", c.Server.UnversionedSunset); err != nil {
+		problems = append(problems, fmt.Sprintf("server.unversioned_sunset (SRV_UNVERSIONED_SUNSET) %q must be a YYYY-MM-DD date", c.Server.UnversionedSunset))
+	}
+	for name, d := range map[string]time.Duration{
+		"server.write_timeout (SRV_WRITE_TIMEOUT)":          c.Server.WriteTimeout,
+		"server.read_timeout (SRV_READ_TIMEOUT)":            c.Server.ReadTimeout,
+		"server.mem_cache_time (SRV_MEMCACHE_TIME_MINUTES)": c.Server.MemCacheTime,
+		"server.shutdown_timeout (SRV_SHUTDOWN_TIMEOUT)":    c.Server.ShutdownTimeout,
+		"redis.dial_timeout (REDIS_DIAL_TIMEOUT)":           c.Redis.DialTimeout,
+		"cors.max_age (CORS_MAX_AGE)":                       c.CORS.MaxAge,
+	} {
+		if d < 0 {
+			problems = append(problems, name+" must not be negative")
+		}
+	}
+	switch c.Trace.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		problems = append(problems, fmt.Sprintf("trace.exporter (TRACE_EXPORTER) %q must be otlp, stdout or empty", c.Trace.Exporter))
+	}
+	if c.Trace.SampleRatio < 0 || c.Trace.SampleRatio > 1 {
+		problems = append(problems, "trace.sample_ratio (TRACE_SAMPLE_RATIO) must be between 0 and 1")
+	}
+	if c.Redis.Network != "tcp" && c.Redis.Network != "unix" {
+		problems = append(problems, fmt.Sprintf("redis.network (REDIS_NETWORK) %q must be tcp or unix", c.Redis.Network))
+	}
+	if c.Redis.PoolSize < 0 || c.Redis.MinIdleConns < 0 || c.Redis.DB < 0 {
+		problems = append(problems, "redis.db, redis.pool_size and redis.min_idle_conns must not be negative")
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// Print Write every effective setting and where it came from, redacting secrets
+func (c *Config) Print(w io.Writer) {
+	for _, s := range c.settings() {
+		value := s.String()
+		if s.Secret && value != "" {
+			value = "[redacted]"
+		}
+		fmt.Fprintf(w, "%-28s = %-24q # %s, from %s\n", s.Key, value, s.Env, c.sources[s.Key])
+	}
+}
+
+// suggest A " (did you mean X?)" hint for a misspelt key, or an empty string
+func suggest[V any](key string, known map[string]V) string {
+	best, bestDistance := "", 3
+	for name := range known {
+		if strings.EqualFold(name, key) {
+			return fmt.Sprintf(" (did you mean %s?)", name)
+		}
+		if d := levenshtein(strings.ToLower(name), strings.ToLower(key)); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (did you mean %s?)", best)
+}
+
+// levenshtein The edit distance between a and b
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// sortedKeys The keys of m in order, so problems are reported deterministically
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// defaultConfig A Config holding only the built-in defaults
+func defaultConfig() *Config {
+	cfg := &Config{sources: make(map[string]string)}
+	for _, s := range cfg.settings() {
+		s.set(s.def, "default")
+		cfg.sources[s.Key] = s.Source
+	}
+	return cfg
+}
+
+// errConfigCommand Returned for unknown config subcommands
+var errConfigCommand = errors.New("usage: config print")
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// splitList The trimmed, non-empty items of a comma separated list
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// originAllowed Reports whether origin matches one of the CORS_ALLOWED_ORIGINS patterns
+func originAllowed(origin string, patterns []string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range patterns {
+		if pattern == "*" {
+			return true
+		}
+		if matched, _ := path.Match(strings.ToLower(pattern), origin); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// setCORSHeaders Allow origin to read the response if the policy allows it, reporting
+// whether it does. Responses vary by Origin unless every origin gets the same answer
+func setCORSHeaders(header http.Header, origin string, policy CORSConfig) bool {
+	origins := splitList(policy.AllowedOrigins)
+	anyOrigin := len(origins) == 1 && origins[0] == "*" && !policy.AllowCredentials
+	if !anyOrigin {
+		header.Add("Vary", "Origin")
+	}
+	if origin == "" || !originAllowed(origin, origins) {
+		return false
+	}
+
+	if anyOrigin {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if policy.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	return true
+}
+
+// cors Middleware applying the CORS policy to a route's responses. It sits outside
+// http-cache so a cached response is never served with another origin's headers
+func cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := currentConfig().CORS
+		if policy.AllowedOrigins != "" && setCORSHeaders(w.Header(), r.Header.Get("Origin"), policy) &&
+			policy.ExposedHeaders != "" {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(splitList(policy.ExposedHeaders), ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preflight Answers OPTIONS for a path served by routes accepting methods: plain
+// requests get the Allow header, CORS preflight requests what the policy allows
+func preflight(methods []string) http.Handler {
+	allow := strings.Join(append(append([]string{}, methods...), http.MethodOptions), ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		origin, method := r.Header.Get("Origin"), r.Header.Get("Access-Control-Request-Method")
+		if origin == "" || method == "" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		policy := currentConfig().CORS
+		if policy.AllowedOrigins == "" || !setCORSHeaders(w.Header(), origin, policy) {
+			HandleProblem(w, r, newProblem(http.StatusForbidden, problemCORSRejected, fmt.Sprintf("Origin %s is not allowed", origin)))
+			return
+		}
+		if !containsString(methods, method) {
+			HandleProblem(w, r, newProblem(http.StatusForbidden, problemCORSRejected, method+" is not supported for "+r.URL.Path))
+			return
+		}
+
+		allowedHeaders := splitList(policy.AllowedHeaders)
+		requested := splitList(r.Header.Get("Access-Control-Request-Headers"))
+		if !containsString(allowedHeaders, "*") {
+			for _, name := range requested {
+				if !containsFold(allowedHeaders, name) {
+					HandleProblem(w, r, newProblem(http.StatusForbidden, problemCORSRejected, fmt.Sprintf("Header %s is not allowed", name)))
+					return
+				}
+			}
+		}
+
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if len(requested) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// containsFold Reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// addPreflights Answer OPTIONS on the path of every route, with the methods of all the
+// routes sharing it on the same listener. Paths without routes are left to the not
+// found handler
+func (R *Router) addPreflights() {
+	for name, table := range R.tables {
+		var paths []Route
+		methods := make(map[string][]string)
+		for _, route := range R.Routes {
+			if !containsString(R.servedOn(route), name) {
+				continue
+			}
+			if methods[route.URI] == nil {
+				paths = append(paths, route)
+			}
+			if !containsString(methods[route.URI], route.Method) {
+				methods[route.URI] = append(methods[route.URI], route.Method)
+			}
+		}
+
+		for _, route := range paths {
+			handler := traceSpan(logRequest(preflight(methods[route.URI]), "Preflight"), "logRequest")
+			handler = traceRequest(requestID(handler), "Preflight")
+			router, path := table.routerFor(route)
+			router.Methods(http.MethodOptions).Path(path).Handler(handler)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/jsanc623/NBC/pb"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formatEncoder Writes responses in one media type. Every format can write station
+// listings; those with encodeDocument can also write single documents such as BikesToReturn
+type formatEncoder struct {
+	Name        string
+	ContentType string
+	// Aliases Other media types that select this encoder
+	Aliases        []string
+	encode         func(w io.Writer, listing *encodedListing) error
+	encodeDocument func(w io.Writer, body interface{}) error
+}
+
+// The response formats
+var (
+	jsonEncoder = formatEncoder{Name: "json", ContentType: "application/json",
+		encode: encodeListingJSON, encodeDocument: encodeDocumentJSON}
+	csvEncoder     = formatEncoder{Name: "csv", ContentType: "text/csv; charset=utf-8", encode: encodeListingCSV}
+	geoJSONEncoder = formatEncoder{Name: "geojson", ContentType: "application/geo+json",
+		Aliases: []string{"application/vnd.geo+json"}, encode: encodeListingGeoJSON}
+	xmlEncoder = formatEncoder{Name: "xml", ContentType: "application/xml; charset=utf-8",
+		Aliases: []string{"text/xml"}, encode: encodeListingXML}
+	protobufEncoder = formatEncoder{Name: "protobuf", ContentType: "application/x-protobuf",
+		Aliases: []string{"application/protobuf", "application/vnd.google.protobuf"},
+		encode:  encodeListingProtobuf, encodeDocument: encodeDocumentProtobuf}
+	msgpackEncoder = formatEncoder{Name: "msgpack", ContentType: "application/msgpack",
+		Aliases: []string{"application/x-msgpack", "application/vnd.msgpack"},
+		encode:  encodeListingMsgpack, encodeDocument: encodeDocumentMsgpack}
+)
+
+// listingEncoders The formats station listings can be written in, in order of
+// preference for wildcard Accept ranges. JSON, the first, is the default. New formats
+// only need adding here
+var listingEncoders = []formatEncoder{jsonEncoder, csvEncoder, geoJSONEncoder, xmlEncoder, protobufEncoder, msgpackEncoder}
+
+// documentEncoders The formats single documents can be written in, JSON first
+var documentEncoders = []formatEncoder{jsonEncoder, protobufEncoder, msgpackEncoder}
+
+// encodedListing A page of stations to encode: the stations themselves, their
+// rendering for the API version and the fields asked for, if any
+type encodedListing struct {
+	stations []Station
+	body     interface{}
+	fields   []string
+}
+
+// formatEncoderNamed The encoder in encoders for ?format=name
+func formatEncoderNamed(encoders []formatEncoder, name string) (formatEncoder, bool) {
+	for _, encoder := range encoders {
+		if encoder.Name == name {
+			return encoder, true
+		}
+	}
+	return formatEncoder{}, false
+}
+
+// negotiateFormat The format of encoders for r: ?format= if given, otherwise the best
+// match for the Accept header, otherwise the first
+func negotiateFormat(r *http.Request, encoders []formatEncoder) (string, *Problem) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := formatEncoderNamed(encoders, format); !ok {
+			return "", newProblem(http.StatusBadRequest, problemInvalidParameter,
+				fmt.Sprintf("Unknown format %q, use one of %s", format, strings.Join(formatNames(encoders), ", ")))
+		}
+		return format, nil
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return encoders[0].Name, nil
+	}
+
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, accepted := range ranges {
+		for _, encoder := range encoders {
+			if acceptsMediaType(accepted.mediaType, encoder) {
+				return encoder.Name, nil
+			}
+		}
+	}
+	return "", newProblem(http.StatusNotAcceptable, problemBlank,
+		"Available as "+strings.Join(mediaTypes(encoders), ", "))
+}
+
+// acceptsMediaType Reports whether an Accept media range selects encoder
+func acceptsMediaType(mediaRange string, encoder formatEncoder) bool {
+	contentType, _, _ := mime.ParseMediaType(encoder.ContentType)
+	for _, mediaType := range append([]string{contentType}, encoder.Aliases...) {
+		if mediaRange == "*/*" || mediaRange == mediaType ||
+			(strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(mediaRange, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatNames The ?format= names of encoders
+func formatNames(encoders []formatEncoder) []string {
+	var names []string
+	for _, encoder := range encoders {
+		names = append(names, encoder.Name)
+	}
+	return names
+}
+
+// mediaTypes The content types of encoders
+func mediaTypes(encoders []formatEncoder) []string {
+	var types []string
+	for _, encoder := range encoders {
+		contentType, _, _ := mime.ParseMediaType(encoder.ContentType)
+		types = append(types, contentType)
+	}
+	return types
+}
+
+// negotiate Middleware which resolves the Accept header of a request to one of
+// encoders as ?format= before the cache, so that each format is cached separately
+func negotiate(next http.Handler, encoders []formatEncoder) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		format, problem := negotiateFormat(r, encoders)
+		if problem != nil {
+			HandleProblem(w, r, problem)
+			return
+		}
+
+		if format != encoders[0].Name && r.URL.Query().Get("format") == "" {
+			query := r.URL.Query()
+			query.Set("format", format)
+			u := *r.URL
+			u.RawQuery = query.Encode()
+			r = r.WithContext(r.Context())
+			r.URL = &u
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeDocument Write body, built from the request's snapshot, with status in the
+// format negotiated for r from documentEncoders
+func writeDocument(w http.ResponseWriter, r *http.Request, body interface{}, status int) {
+	encoder, ok := formatEncoderNamed(documentEncoders, r.URL.Query().Get("format"))
+	if !ok {
+		encoder = jsonEncoder
+	}
+	if status == http.StatusOK {
+		setSnapshotHeaders(w, r, encoder.Name)
+	}
+	if encoder.Name == jsonEncoder.Name {
+		HandleResponse(w, r, body, status)
+		return
+	}
+
+	var buffer bytes.Buffer
+	if err := encoder.encodeDocument(&buffer, body); err != nil {
+		HandleProblem(w, r, newProblem(http.StatusInternalServerError, problemBlank, err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", encoder.ContentType)
+	w.Header().Set("X-App-Name", fmt.Sprintf("%s %s", App.Name, App.Version))
+	w.WriteHeader(status)
+	_, err := buffer.WriteTo(w)
+	handleRequestError(r.Context(), "writeDocument", err)
+}
+
+// encodeDocumentJSON body as JSON
+func encodeDocumentJSON(w io.Writer, body interface{}) error {
+	return json.NewEncoder(w).Encode(body)
+}
+
+// protoMessage The protobuf message for a rendered response body
+func protoMessage(body interface{}) (proto.Message, error) {
+	switch body := body.(type) {
+	case []ShortStation:
+		return pb.FromShortStations(body), nil
+	case StationPage:
+		return pb.FromStationPage(body), nil
+	case BikesToReturn:
+		return pb.FromBikesToReturn(body), nil
+	case Station:
+		return pb.FromStation(body), nil
+	}
+	return nil, fmt.Errorf("no protobuf message for %T", body)
+}
+
+// encodeDocumentProtobuf body as its message in pb/stations.proto
+func encodeDocumentProtobuf(w io.Writer, body interface{}) error {
+	message, err := protoMessage(body)
+	if err != nil {
+		return err
+	}
+	out, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// encodeListingProtobuf The rendered listing as a ShortStationList or StationPage
+// message. Station fields that weren't asked for are cleared, which leaves them out
+// of the encoding
+func encodeListingProtobuf(w io.Writer, listing *encodedListing) error {
+	message, err := protoMessage(listing.body)
+	if err != nil {
+		return err
+	}
+
+	if len(listing.fields) > 0 {
+		stations := message.ProtoReflect()
+		items := stations.Get(stations.Descriptor().Fields().ByName("stations")).List()
+		for i := 0; i < items.Len(); i++ {
+			item := items.Get(i).Message()
+			item.Range(func(field protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+				if !containsString(listing.fields, field.JSONName()) {
+					item.Clear(field)
+				}
+				return true
+			})
+		}
+	}
+
+	out, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// encodeDocumentMsgpack body as MessagePack, with the same keys as its JSON
+func encodeDocumentMsgpack(w io.Writer, body interface{}) error {
+	encoder := msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	return encoder.Encode(body)
+}
+
+// encodeListingMsgpack The rendered listing as MessagePack, projected to the fields
+// asked for
+func encodeListingMsgpack(w io.Writer, listing *encodedListing) error {
+	body := listing.body
+	if len(listing.fields) > 0 {
+		body = project(body, listing.fields)
+	}
+	return encodeDocumentMsgpack(w, body)
+}
+
+// encodeListingJSON The rendered listing as JSON, projected to the fields asked for
+func encodeListingJSON(w io.Writer, listing *encodedListing) error {
+	body := listing.body
+	if len(listing.fields) > 0 {
+		body = project(body, listing.fields)
+	}
+	return json.NewEncoder(w).Encode(body)
+}
+
+// encodeListingCSV One row per station with a header row. Nested objects are
+// flattened into dotted columns such as address.street1
+func encodeListingCSV(w io.Writer, listing *encodedListing) error {
+	items := listingItems(listing.body)
+	columns := listingColumns(items.Type().Elem(), nil, "", listing.fields)
+
+	out := csv.NewWriter(w)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.name
+	}
+	out.Write(header)
+	for i := 0; i < items.Len(); i++ {
+		row := make([]string, len(columns))
+		for n, column := range columns {
+			row[n] = fmt.Sprint(items.Index(i).FieldByIndex(column.index).Interface())
+		}
+		out.Write(row)
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// encodeListingGeoJSON A FeatureCollection of Point features, one per station, with
+// the rendered station as its properties
+func encodeListingGeoJSON(w io.Writer, listing *encodedListing) error {
+	body, err := json.Marshal(listing.body)
+	if err != nil {
+		return err
+	}
+	var generic interface{}
+	json.Unmarshal(body, &generic)
+	properties, _ := generic.([]interface{})
+	if object, ok := generic.(map[string]interface{}); ok {
+		properties, _ = object["stations"].([]interface{})
+	}
+
+	keep := make(map[string]bool)
+	for _, field := range listing.fields {
+		keep[field] = true
+	}
+	features := make([]interface{}, 0, len(listing.stations))
+	for i, station := range listing.stations {
+		feature := map[string]interface{}{
+			"type": "Feature",
+			"id":   station.Id,
+			"geometry": map[string]interface{}{
+				"type":        "Point",
+				"coordinates": []float64{station.Longitude, station.Latitude},
+			},
+		}
+		if i < len(properties) {
+			if object, ok := properties[i].(map[string]interface{}); ok && len(keep) > 0 {
+				for name := range object {
+					if !keep[name] {
+						delete(object, name)
+					}
+				}
+			}
+			feature["properties"] = properties[i]
+		}
+		features = append(features, feature)
+	}
+
+	return json.NewEncoder(w).Encode(map[string]interface{}{"type": "FeatureCollection", "features": features})
+}
+
+// encodeListingXML A <stations> document with a <station> element per station,
+// using the JSON field names as element names
+func encodeListingXML(w io.Writer, listing *encodedListing) error {
+	io.WriteString(w, xml.Header)
+	out := xml.NewEncoder(w)
+	out.Indent("", "  ")
+
+	root := xml.StartElement{Name: xml.Name{Local: "stations"}}
+	if page, ok := listing.body.(StationPage); ok {
+		for _, attr := range []struct {
+			name  string
+			value int
+		}{{"total", page.Total}, {"page", page.Page}, {"perPage", page.PerPage}, {"totalPages", page.TotalPages}} {
+			root.Attr = append(root.Attr, xml.Attr{Name: xml.Name{Local: attr.name}, Value: strconv.Itoa(attr.value)})
+		}
+		if page.NextCursor != "" {
+			root.Attr = append(root.Attr, xml.Attr{Name: xml.Name{Local: "nextCursor"}, Value: page.NextCursor})
+		}
+	}
+	out.EncodeToken(root)
+
+	items := listingItems(listing.body)
+	keep := make(map[string]bool)
+	for _, field := range listing.fields {
+		keep[field] = true
+	}
+	for i := 0; i < items.Len(); i++ {
+		if err := encodeXMLElement(out, "station", items.Index(i), keep); err != nil {
+			return err
+		}
+	}
+
+	out.EncodeToken(root.End())
+	if err := out.Flush(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// encodeXMLElement Write v as element name, with a child element per JSON field.
+// Fields left out of JSON by omitempty are left out here too
+func encodeXMLElement(out *xml.Encoder, name string, v reflect.Value, keep map[string]bool) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if v.Kind() != reflect.Struct {
+		return out.EncodeElement(fmt.Sprint(v.Interface()), start)
+	}
+
+	out.EncodeToken(start)
+	for _, field := range jsonFields(v.Type()) {
+		fieldName, omitEmpty := jsonName(field)
+		value := v.FieldByIndex(field.Index)
+		if (len(keep) > 0 && !keep[fieldName]) || (omitEmpty && value.IsZero()) {
+			continue
+		}
+		if err := encodeXMLElement(out, fieldName, value, nil); err != nil {
+			return err
+		}
+	}
+	return out.EncodeToken(start.End())
+}
+
+// listingColumn A CSV column and where its value is in a rendered station
+type listingColumn struct {
+	name  string
+	index []int
+}
+
+// listingColumns The CSV columns of station type t, in field order, limited to fields
+func listingColumns(t reflect.Type, index []int, prefix string, fields []string) []listingColumn {
+	var columns []listingColumn
+	for _, field := range jsonFields(t) {
+		name, _ := jsonName(field)
+		if prefix == "" && len(fields) > 0 && !containsString(fields, name) {
+			continue
+		}
+		fieldIndex := append(append([]int{}, index...), field.Index...)
+		if field.Type.Kind() == reflect.Struct {
+			columns = append(columns, listingColumns(field.Type, fieldIndex, prefix+name+".", nil)...)
+			continue
+		}
+		columns = append(columns, listingColumn{name: prefix + name, index: fieldIndex})
+	}
+	return columns
+}
+
+// listingItems The rendered stations of a listing body: the body itself, or the
+// Stations of a page
+func listingItems(body interface{}) reflect.Value {
+	v := reflect.ValueOf(body)
+	if v.Kind() == reflect.Struct {
+		v = v.FieldByName("Stations")
+	}
+	return v
+}
+
+// jsonName The JSON name of field and whether it is omitted when empty
+func jsonName(field reflect.StructField) (string, bool) {
+	parts := strings.Split(field.Tag.Get("json"), ",")
+	name := parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			return name, true
+		}
+	}
+	return name, false
+}
+
+// containsString Reports whether values contains value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
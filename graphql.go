@@ -0,0 +1,559 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxGraphQLBody The largest /graphql request body read
+const maxGraphQLBody = 1 << 20
+
+// graphQLListSize The number of items assumed for lists without a limit when
+// estimating the complexity of an operation
+const graphQLListSize = 100
+
+// graphQLListFields The fields returning lists of stations, whose selections cost
+// once per station
+var graphQLListFields = map[string]bool{"stations": true, "near": true, "search": true}
+
+// graphQLTypeNames GraphQL names for model types whose Go names read oddly in a schema
+var graphQLTypeNames = map[string]string{"StationDetail": "Station"}
+
+// errGraphQLUpstream The error resolvers report when the feed can't be loaded
+var errGraphQLUpstream = errors.New("The CitiBike feed could not be loaded")
+
+// graphQLSchema The /graphql schema. Object types are built from the model types'
+// JSON fields, so they stay in step with the REST representations
+var graphQLSchema, graphQLSchemaErr = buildGraphQLSchema()
+
+// buildGraphQLSchema The queries over the station snapshot and the stationUpdates subscription
+func buildGraphQLSchema() (graphql.Schema, error) {
+	types := make(map[string]*graphql.Object)
+	station := graphQLOutput(reflect.TypeOf(StationDetail{}), types)
+	stations := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(station)))
+
+	near := filterArguments()
+	near["lat"] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)}
+	near["lon"] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Float)}
+	near["radius"] = &graphql.ArgumentConfig{Type: graphql.Float, DefaultValue: 500.0, Description: "Meters"}
+	search := filterArguments()
+	search["query"] = &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.String)}
+
+	query := graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: graphql.Fields{
+		"stations": {Type: stations, Args: filterArguments(), Resolve: resolveStations,
+			Description: "Stations matching the filters, by ID unless sorted otherwise"},
+		"station": {Type: station, Resolve: resolveStation, Description: "A station by ID, null if there is none",
+			Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.Int)}}},
+		"near": {Type: stations, Args: near, Resolve: resolveNear,
+			Description: "Stations within radius of a point, nearest first unless sorted otherwise, with their distance"},
+		"search": {Type: stations, Args: search, Resolve: resolveSearch,
+			Description: "Ranked, typo-tolerant search of station names and addresses, best first, with scores"},
+		"dockable": {Type: graphql.NewNonNull(graphQLOutput(reflect.TypeOf(BikesToReturn{}), types)), Resolve: resolveDockable,
+			Description: "Whether a station has enough docks to return bikes",
+			Args: graphql.FieldConfigArgument{
+				"stationId":     {Type: graphql.NewNonNull(graphql.Int)},
+				"bikesToReturn": {Type: graphql.NewNonNull(graphql.Int)},
+			}},
+	}})
+
+	updates := filterArguments()
+	delete(updates, "sort")
+	delete(updates, "limit")
+	subscription := graphql.NewObject(graphql.ObjectConfig{Name: "Subscription", Fields: graphql.Fields{
+		"stationUpdates": {Type: graphql.NewNonNull(graphQLOutput(reflect.TypeOf(StationUpdate{}), types)), Args: updates,
+			Subscribe: subscribeStationUpdates,
+			Resolve:   func(p graphql.ResolveParams) (interface{}, error) { return p.Source, nil },
+			Description: "The stations matching the filters, then each one that changes, appears or goes away " +
+				"as the snapshot is refreshed"},
+	}})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Subscription: subscription})
+}
+
+// graphQLOutput The GraphQL type for Go type t. Structs become objects with a field per
+// JSON field, non-null unless omitempty
+func graphQLOutput(t reflect.Type, types map[string]*graphql.Object) graphql.Output {
+	switch t.Kind() {
+	case reflect.Int:
+		return graphql.Int
+	case reflect.Float64:
+		return graphql.Float
+	case reflect.Bool:
+		return graphql.Boolean
+	case reflect.Struct:
+		name := t.Name()
+		if rename, ok := graphQLTypeNames[name]; ok {
+			name = rename
+		}
+		if object, ok := types[name]; ok {
+			return object
+		}
+
+		fields := make(graphql.Fields)
+		for _, field := range jsonFields(t) {
+			fieldName, omitEmpty := jsonName(field)
+			output := graphQLOutput(field.Type, types)
+			if !omitEmpty {
+				output = graphql.NewNonNull(output)
+			}
+			fields[fieldName] = &graphql.Field{Type: output}
+		}
+		types[name] = graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: fields})
+		return types[name]
+	}
+	return graphql.String
+}
+
+// graphQLFilter Filters on any Station field, as the REST listings accept them
+var graphQLFilter = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name:        "Filter",
+	Description: "A filter as the REST listings accept it: status, minBikes, minDocks or any Station field by its JSON name. A station matching any of the values passes",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":   {Type: graphql.NewNonNull(graphql.String)},
+		"values": {Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(graphql.String)))},
+	},
+})
+
+// graphQLServiceStatus The values of the status argument
+var graphQLServiceStatus = graphql.NewEnum(graphql.EnumConfig{
+	Name: "ServiceStatus",
+	Values: graphql.EnumValueConfigMap{
+		"IN_SERVICE":     {Value: "in-service"},
+		"NOT_IN_SERVICE": {Value: "not-in-service"},
+	},
+})
+
+// filterArguments The arguments station lists take: the common filters, any other
+// filter, sort fields and a limit
+func filterArguments() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"status":     {Type: graphQLServiceStatus},
+		"minBikes":   {Type: graphql.Int, Description: "At least this many available bikes"},
+		"minDocks":   {Type: graphql.Int, Description: "At least this many available docks"},
+		"city":       {Type: graphql.String},
+		"postalCode": {Type: graphql.String},
+		"filters":    {Type: graphql.NewList(graphql.NewNonNull(graphQLFilter)), Description: "Combined with AND"},
+		"sort":       {Type: graphql.NewList(graphql.NewNonNull(graphql.String)), Description: "Station fields by JSON name, prefixed with - for descending"},
+		"limit":      {Type: graphql.Int, Description: "At most this many stations"},
+	}
+}
+
+// graphQLQuery The station query for a field's filter and sort arguments
+func graphQLQuery(args map[string]interface{}) (*stationQuery, error) {
+	values := make(url.Values)
+	for _, name := range []string{"status", "city", "postalCode"} {
+		if value, ok := args[name].(string); ok {
+			values.Set(name, value)
+		}
+	}
+	for _, name := range []string{"minBikes", "minDocks"} {
+		if value, ok := args[name].(int); ok {
+			values.Set(name, strconv.Itoa(value))
+		}
+	}
+	filters, _ := args["filters"].([]interface{})
+	for _, filter := range filters {
+		filter, _ := filter.(map[string]interface{})
+		name, _ := filter["name"].(string)
+		if !isFilter(name) {
+			return nil, fmt.Errorf("Unknown filter %q%s", name, suggest(name, stationFields))
+		}
+		list, _ := filter["values"].([]interface{})
+		if len(list) == 0 {
+			return nil, fmt.Errorf("Filter %q has no values", name)
+		}
+		for _, value := range list {
+			values.Add(name, fmt.Sprint(value))
+		}
+	}
+	if sortBy, ok := args["sort"].([]interface{}); ok && len(sortBy) > 0 {
+		fields := make([]string, len(sortBy))
+		for i, field := range sortBy {
+			fields[i] = fmt.Sprint(field)
+		}
+		values.Set("sort", strings.Join(fields, ","))
+	}
+
+	query, problem := parseStationValues(values)
+	if problem != nil {
+		return nil, errors.New(problem.Detail)
+	}
+	return query, nil
+}
+
+// graphQLSnapshot The current stations, as getJSON loads them for the REST handlers
+func graphQLSnapshot(ctx context.Context) ([]Station, error) {
+	var stations Stations
+	stationList, err := stations.getJSON(ctx)
+	if err != nil {
+		return nil, errGraphQLUpstream
+	}
+	return stationList, nil
+}
+
+// limitStations The first limit stations, all of them without a limit
+func limitStations(stations []Station, args map[string]interface{}) ([]Station, error) {
+	limit, ok := args["limit"].(int)
+	if !ok {
+		return stations, nil
+	}
+	if limit < 0 {
+		return nil, errors.New("limit must not be negative")
+	}
+	if len(stations) > limit {
+		stations = stations[:limit]
+	}
+	return stations, nil
+}
+
+// resolveStations The stations kept by the filters
+func resolveStations(p graphql.ResolveParams) (interface{}, error) {
+	query, err := graphQLQuery(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	stations, err := graphQLSnapshot(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	matched, order := selectStations(stations, query, nil)
+	matched, err = limitStations(sortStations(matched, order), p.Args)
+	if err != nil {
+		return nil, err
+	}
+	return toStationDetails(matched), nil
+}
+
+// resolveStation The station with the id argument, or null
+func resolveStation(p graphql.ResolveParams) (interface{}, error) {
+	stations, err := graphQLSnapshot(p.Context)
+	if err != nil {
+		return nil, err
+	}
+	station, ok := findStation(stations, p.Args["id"].(int))
+	if !ok {
+		return nil, nil
+	}
+	return toStationDetails([]Station{station})[0], nil
+}
+
+// resolveNear The stations kept by the filters within radius meters of lat, lon
+func resolveNear(p graphql.ResolveParams) (interface{}, error) {
+	lat, lon, radius := p.Args["lat"].(float64), p.Args["lon"].(float64), p.Args["radius"].(float64)
+	switch {
+	case lat < -90 || lat > 90:
+		return nil, errors.New("Invalid lat")
+	case lon < -180 || lon > 180:
+		return nil, errors.New("Invalid lon")
+	case radius <= 0:
+		return nil, errors.New("Invalid radius")
+	}
+	query, err := graphQLQuery(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	stations, err := graphQLSnapshot(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	near, order, distances := stationsNear(stations, lat, lon, radius, query)
+	near, err = limitStations(sortStations(near, order), p.Args)
+	if err != nil {
+		return nil, err
+	}
+	details := toStationDetails(near)
+	for i := range details {
+		details[i].Distance = math.Round(distances[details[i].ID])
+	}
+	return details, nil
+}
+
+// resolveSearch The stations kept by the filters that match the search query, best first
+func resolveSearch(p graphql.ResolveParams) (interface{}, error) {
+	search := strings.TrimSpace(p.Args["query"].(string))
+	if search == "" {
+		return nil, errors.New("Missing query")
+	}
+	query, err := graphQLQuery(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	stations, err := graphQLSnapshot(p.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	scored := indexFor(stations).search(search, false)
+	if scored == nil {
+		scored = map[int]float64{}
+	}
+	matched, order := selectStations(stations, query, scored)
+	matched, err = limitStations(sortStations(matched, order), p.Args)
+	if err != nil {
+		return nil, err
+	}
+	details := toStationDetails(matched)
+	for i := range details {
+		details[i].Score = scored[details[i].ID]
+	}
+	return details, nil
+}
+
+// resolveDockable Whether bikesToReturn bikes can be docked at stationId
+func resolveDockable(p graphql.ResolveParams) (interface{}, error) {
+	stationId, bikesToReturn := p.Args["stationId"].(int), p.Args["bikesToReturn"].(int)
+	if bikesToReturn < 0 {
+		return nil, errors.New("Invalid num bikes to return")
+	}
+	stations, err := graphQLSnapshot(p.Context)
+	if err != nil {
+		return nil, err
+	}
+	station, ok := findStation(stations, stationId)
+	if !ok {
+		return nil, errors.New(stationNotFound(stationId).Detail)
+	}
+	return dockability(station, bikesToReturn), nil
+}
+
+// subscribeStationUpdates Watch the stations kept by the filters until the
+// subscription's context is done, checking the snapshot every GRAPHQL_WATCH_INTERVAL
+func subscribeStationUpdates(p graphql.ResolveParams) (interface{}, error) {
+	query, err := graphQLQuery(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := graphQLSnapshot(p.Context); err != nil {
+		return nil, err
+	}
+
+	updates := make(chan interface{})
+	go func() {
+		defer close(updates)
+		err := watchStations(p.Context, query, func() time.Duration {
+			return currentConfig().GraphQL.WatchInterval
+		}, func(update StationUpdate) error {
+			select {
+			case updates <- update:
+				return nil
+			case <-p.Context.Done():
+				return p.Context.Err()
+			}
+		})
+		if err != nil && err != context.Canceled {
+			handleRequestError(p.Context, "subscribeStationUpdates", err)
+		}
+	}()
+	return updates, nil
+}
+
+// graphQLOperation The operation in document to run: the one named, or the first
+func graphQLOperation(document *ast.Document, name string) *ast.OperationDefinition {
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if ok && (name == "" || (operation.Name != nil && operation.Name.Value == name)) {
+			return operation
+		}
+	}
+	return nil
+}
+
+// graphQLCost The depth of operation and its estimated complexity: a point per field,
+// with the selections of station lists counted once per station they may return.
+// Introspection fields are free
+func graphQLCost(document *ast.Document, operation *ast.OperationDefinition, variables map[string]interface{}) (int, int) {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	visiting := make(map[string]bool)
+	var walk func(set *ast.SelectionSet) (int, int)
+	walk = func(set *ast.SelectionSet) (depth int, complexity int) {
+		if set == nil {
+			return 0, 0
+		}
+		for _, selection := range set.Selections {
+			var childDepth, childComplexity int
+			switch selection := selection.(type) {
+			case *ast.Field:
+				if strings.HasPrefix(selection.Name.Value, "__") {
+					continue
+				}
+				childDepth, childComplexity = walk(selection.SelectionSet)
+				childDepth++
+				childComplexity = 1 + graphQLListLength(selection, variables)*childComplexity
+			case *ast.InlineFragment:
+				childDepth, childComplexity = walk(selection.SelectionSet)
+			case *ast.FragmentSpread:
+				fragment, ok := fragments[selection.Name.Value]
+				if !ok || visiting[fragment.Name.Value] {
+					continue
+				}
+				visiting[fragment.Name.Value] = true
+				childDepth, childComplexity = walk(fragment.SelectionSet)
+				delete(visiting, fragment.Name.Value)
+			}
+			if childDepth > depth {
+				depth = childDepth
+			}
+			complexity += childComplexity
+		}
+		return depth, complexity
+	}
+	return walk(operation.SelectionSet)
+}
+
+// graphQLListLength How many items field may return: its limit for station lists,
+// graphQLListSize if it has none, otherwise 1
+func graphQLListLength(field *ast.Field, variables map[string]interface{}) int {
+	if !graphQLListFields[field.Name.Value] {
+		return 1
+	}
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "limit" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if limit, err := strconv.Atoi(value.Value); err == nil && limit >= 0 {
+				return limit
+			}
+		case *ast.Variable:
+			if limit, ok := variables[value.Name.Value].(float64); ok && limit >= 0 {
+				return int(limit)
+			}
+		}
+	}
+	return graphQLListSize
+}
+
+// graphQLRequest The body of a POST to /graphql
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// PostGraphQL Runs a GraphQL operation after checking it against the depth and
+// complexity limits. Subscriptions are streamed as server-sent events
+func PostGraphQL(w http.ResponseWriter, r *http.Request) {
+	var request graphQLRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxGraphQLBody)).Decode(&request); err != nil || strings.TrimSpace(request.Query) == "" {
+		HandleProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "The body must be a JSON object with a query"))
+		return
+	}
+	if graphQLSchemaErr != nil {
+		HandleProblem(w, r, newProblem(http.StatusInternalServerError, problemBlank, graphQLSchemaErr.Error()))
+		return
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(request.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		HandleResponse(w, r, &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, http.StatusOK)
+		return
+	}
+	operation := graphQLOperation(document, request.OperationName)
+	if operation == nil {
+		HandleResponse(w, r, &graphql.Result{Errors: gqlerrors.FormatErrors(fmt.Errorf("Unknown operation %q", request.OperationName))}, http.StatusOK)
+		return
+	}
+
+	limits := currentConfig().GraphQL
+	depth, complexity := graphQLCost(document, operation, request.Variables)
+	if depth > limits.MaxDepth {
+		HandleResponse(w, r, &graphql.Result{Errors: gqlerrors.FormatErrors(fmt.Errorf("Query depth %d exceeds the limit of %d", depth, limits.MaxDepth))}, http.StatusOK)
+		return
+	}
+	if complexity > limits.MaxComplexity {
+		HandleResponse(w, r, &graphql.Result{Errors: gqlerrors.FormatErrors(fmt.Errorf("Query complexity %d exceeds the limit of %d", complexity, limits.MaxComplexity))}, http.StatusOK)
+		return
+	}
+
+	params := graphql.Params{
+		Schema:         graphQLSchema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        r.Context(),
+	}
+	if operation.Operation == ast.OperationTypeSubscription {
+		streamGraphQL(w, r, params)
+		return
+	}
+	HandleResponse(w, r, graphql.Do(params), http.StatusOK)
+}
+
+// streamGraphQL Run a subscription, writing each result as a server-sent "next" event
+// and a "complete" event once it ends. Neither the write timeout nor the route's
+// deadline apply to the stream
+func streamGraphQL(w http.ResponseWriter, r *http.Request, params graphql.Params) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		HandleResponse(w, r, &graphql.Result{Errors: gqlerrors.FormatErrors(errors.New("Subscriptions are streamed as server-sent events, send Accept: text/event-stream"))}, http.StatusOK)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(untimedContext(r))
+	params.Context = ctx
+	results := graphql.Subscribe(params)
+	defer func() {
+		cancel()
+		// Let the subscription finish sending a result it was blocked on
+		go func() {
+			for range results {
+			}
+		}()
+	}()
+
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-App-Name", fmt.Sprintf("%s %s", App.Name, App.Version))
+	w.WriteHeader(http.StatusOK)
+	controller.Flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result, ok := <-results:
+			if !ok {
+				fmt.Fprint(w, "event: complete\ndata:\n\n")
+				controller.Flush()
+				return
+			}
+			data, err := json.Marshal(result)
+			if err != nil {
+				handleRequestError(r.Context(), "streamGraphQL", err)
+				return
+			}
+			fmt.Fprintf(w, "event: next\ndata: %s\n\n", data)
+			if err := controller.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
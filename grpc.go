@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/jsanc623/NBC/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// grpcRequestIDKey The metadata key carrying the request ID, as X-Request-Id does over HTTP
+const grpcRequestIDKey = "x-request-id"
+
+// grpcCodes The gRPC code for each problem status
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusBadGateway:          codes.Unavailable,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// stationServer Implements pb.StationsServer over the same snapshot and query engine
+// as the REST handlers
+type stationServer struct {
+	pb.UnimplementedStationsServer
+}
+
+// newGRPCServer The gRPC server with the station service, health checking and,
+// if enabled, reflection. Health reports NOT_SERVING until the feed has loaded
+func newGRPCServer(cfg GRPCConfig) (*grpc.Server, *health.Server) {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(grpcUnaryInterceptor),
+		grpc.ChainStreamInterceptor(grpcStreamInterceptor),
+	)
+	pb.RegisterStationsServer(server, &stationServer{})
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	healthServer.SetServingStatus(pb.Stations_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+
+	if cfg.Reflection {
+		reflection.Register(server)
+	}
+	return server, healthServer
+}
+
+// serveGRPC Serve server on listener until it is stopped, marking it healthy once
+// the feed is ready
+func serveGRPC(server *grpc.Server, healthServer *health.Server, listener net.Listener) error {
+	go reportGRPCHealth(background, healthServer)
+	return server.Serve(listener)
+}
+
+// reportGRPCHealth Mark the gRPC services as serving once the feed has been loaded
+func reportGRPCHealth(ctx context.Context, healthServer *health.Server) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for !feed.ready() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(pb.Stations_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+}
+
+// stopGRPC Drain the gRPC server, stopping it outright if ctx expires first.
+// WatchStations streams end when background is cancelled
+func stopGRPC(ctx context.Context, server *grpc.Server, healthServer *health.Server) {
+	healthServer.Shutdown()
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
+// grpcContext Accept or generate a request ID from the call's metadata, store it in
+// ctx as the requestID middleware does and send it back as a header
+func grpcContext(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(grpcRequestIDKey)) > 0 {
+		id = md.Get(grpcRequestIDKey)[0]
+	}
+	if !validRequestID(id) {
+		id = nextRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, id))
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// logGRPC Record metrics and an access log entry for a completed call
+func logGRPC(ctx context.Context, method string, start time.Time, err error) {
+	httpStatus := grpcHTTPStatus(status.Code(err))
+	latency := time.Since(start)
+	observeRequest(method, httpStatus, latency, "")
+	if !logEnabled(levelInfo) {
+		return
+	}
+	App.AccessLog.Write(accessLogEntry{
+		Time:      start.UTC().Format(time.RFC3339Nano),
+		RequestID: requestIDFromContext(ctx),
+		Method:    "GRPC",
+		Route:     method,
+		URI:       method,
+		Status:    httpStatus,
+		LatencyMS: float64(latency) / float64(time.Millisecond),
+	})
+}
+
+// grpcHTTPStatus The HTTP status equivalent to code, for metrics and the access log
+func grpcHTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Canceled:
+		return 499
+	}
+	return http.StatusInternalServerError
+}
+
+// grpcUnaryInterceptor Request IDs and access logging for unary calls
+func grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	ctx = grpcContext(ctx)
+	resp, err := handler(ctx, req)
+	logGRPC(ctx, info.FullMethod, start, err)
+	return resp, err
+}
+
+// grpcStreamInterceptor Request IDs and access logging for streaming calls
+func grpcStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := grpcContext(stream.Context())
+	err := handler(srv, &grpcStream{ServerStream: stream, ctx: ctx})
+	logGRPC(ctx, info.FullMethod, start, err)
+	return err
+}
+
+// grpcStream A ServerStream with the context set up by grpcContext
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context The stream's context, carrying its request ID
+func (s *grpcStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcError The gRPC status for problem
+func grpcError(problem *Problem) error {
+	code, ok := grpcCodes[problem.Status]
+	if !ok {
+		code = codes.Unknown
+	}
+	return status.Error(code, problem.Detail)
+}
+
+// grpcSnapshot The current stations, as getJSON loads them for the REST handlers
+func grpcSnapshot(ctx context.Context) ([]Station, error) {
+	var stations Stations
+	stationList, err := stations.getJSON(ctx)
+	if err != nil {
+		return nil, grpcError(upstreamProblem(ctx))
+	}
+	return stationList, nil
+}
+
+// grpcQuery The station query for filters and sort, which take the same names and
+// values as the REST query parameters
+func grpcQuery(filters []*pb.Filter, sortBy []string) (*stationQuery, error) {
+	values := make(url.Values)
+	for _, filter := range filters {
+		if !isFilter(filter.GetName()) {
+			return nil, status.Errorf(codes.InvalidArgument, "Unknown filter %q%s", filter.GetName(), suggest(filter.GetName(), stationFields))
+		}
+		if len(filter.GetValues()) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "Filter %q has no values", filter.GetName())
+		}
+		values[filter.GetName()] = append(values[filter.GetName()], filter.GetValues()...)
+	}
+	if len(sortBy) > 0 {
+		values.Set("sort", strings.Join(sortBy, ","))
+	}
+
+	query, problem := parseStationValues(values)
+	if problem != nil {
+		return nil, grpcError(problem)
+	}
+	return query, nil
+}
+
+// ListStations Streams the stations kept by the request's filters, sorted as asked
+func (s *stationServer) ListStations(req *pb.ListStationsRequest, stream pb.Stations_ListStationsServer) error {
+	query, err := grpcQuery(req.GetFilters(), req.GetSort())
+	if err != nil {
+		return err
+	}
+	stations, err := grpcSnapshot(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	matched, order := selectStations(stations, query, nil)
+	for _, detail := range toStationDetails(sortStations(matched, order)) {
+		if err := stream.Send(pb.FromStationDetail(detail)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetStation The station with the requested ID
+func (s *stationServer) GetStation(ctx context.Context, req *pb.GetStationRequest) (*pb.StationDetail, error) {
+	stations, err := grpcSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	station, ok := findStation(stations, int(req.GetId()))
+	if !ok {
+		return nil, grpcError(stationNotFound(int(req.GetId())))
+	}
+	return pb.FromStationDetail(toStationDetails([]Station{station})[0]), nil
+}
+
+// SearchStations The stations matching the search query and filters, best first
+func (s *stationServer) SearchStations(ctx context.Context, req *pb.SearchStationsRequest) (*pb.SearchStationsResponse, error) {
+	if strings.TrimSpace(req.GetQuery()) == "" {
+		return nil, status.Error(codes.InvalidArgument, "Missing query")
+	}
+	if req.GetLimit() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	query, err := grpcQuery(req.GetFilters(), nil)
+	if err != nil {
+		return nil, err
+	}
+	stations, err := grpcSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scored := indexFor(stations).search(req.GetQuery(), false)
+	if scored == nil {
+		scored = map[int]float64{}
+	}
+	matched, order := selectStations(stations, query, scored)
+	matched = sortStations(matched, order)
+	if limit := int(req.GetLimit()); limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+	}
+
+	response := &pb.SearchStationsResponse{}
+	for _, detail := range toStationDetails(matched) {
+		detail.Score = scored[detail.ID]
+		response.Stations = append(response.Stations, pb.FromStationDetail(detail))
+	}
+	return response, nil
+}
+
+// CheckDockable Whether the requested number of bikes can be docked at a station
+func (s *stationServer) CheckDockable(ctx context.Context, req *pb.CheckDockableRequest) (*pb.BikesToReturn, error) {
+	if req.GetBikesToReturn() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "Invalid num bikes to return")
+	}
+	stations, err := grpcSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	station, ok := findStation(stations, int(req.GetStationId()))
+	if !ok {
+		return nil, grpcError(stationNotFound(int(req.GetStationId())))
+	}
+	return pb.FromBikesToReturn(dockability(station, int(req.GetBikesToReturn()))), nil
+}
+
+// WatchStations Streams the stations kept by the filters, then those that change,
+// appear or go away, checking the snapshot every GRPC_WATCH_INTERVAL
+func (s *stationServer) WatchStations(req *pb.WatchStationsRequest, stream pb.Stations_WatchStationsServer) error {
+	query, err := grpcQuery(req.GetFilters(), nil)
+	if err != nil {
+		return err
+	}
+
+	err = watchStations(stream.Context(), query, func() time.Duration {
+		return currentConfig().GRPC.WatchInterval
+	}, func(update StationUpdate) error {
+		return stream.Send(&pb.StationUpdate{Station: pb.FromStationDetail(update.Station), Removed: update.Removed})
+	})
+	switch err {
+	case errFeedUnavailable:
+		return grpcError(upstreamProblem(stream.Context()))
+	case errShuttingDown:
+		return status.Error(codes.Unavailable, "Server is shutting down")
+	}
+	return err
+}
+
+// grpcAddress The address the gRPC server listens on
+func grpcAddress(cfg GRPCConfig) string {
+	return fmt.Sprintf("%s:%s", cfg.Address, cfg.Port)
+}
@@ -3,51 +3,44 @@ package main
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/sphireco/mantis"
 	"net/http"
-	"strconv"
-	"time"
 )
 
 // HandleResponse Handles general responses via JSON
-func HandleResponse(w http.ResponseWriter, val interface{}, status int) {
-	// Set session token if available, as well as app name, request ID (for tracing) and version
-	w.Header().Set("X-Session-Token", nextRequestID())
-	w.Header().Set("X-Request-Id", nextRequestID())
+func HandleResponse(w http.ResponseWriter, r *http.Request, val interface{}, status int) {
+	// Set the session token to the request ID, as well as app name and version;
+	// X-Request-Id is applied by the requestID middleware
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(sessionTokenHeader, requestIDFromContext(r.Context()))
 	w.Header().Set("X-App-Name", fmt.Sprintf("%s %s", App.Name, App.Version))
 	w.WriteHeader(status)
 
 	// Output via a json encoder stream
-	mantis.HandleError("HandleResponse Encode", json.NewEncoder(w).Encode(val))
+	handleRequestError(r.Context(), "HandleResponse Encode", json.NewEncoder(w).Encode(val))
 }
 
-// NotFoundServer Handles all not found with a simple error
+// NotFoundServer Handles all not found with a problem
 func NotFoundServer(w http.ResponseWriter, req *http.Request) {
-	HandleResponse(w, "404 Not Found", http.StatusNotFound)
+	HandleProblem(w, req, newProblem(http.StatusNotFound, problemBlank, "No route matches "+req.URL.Path))
 }
 
-// HomeServer Basic status and root handler
-func HomeServer(w http.ResponseWriter, req *http.Request) {
-	HandleResponse(w, "200 OK", http.StatusOK)
+// MethodNotAllowedServer Handles requests for a known path with an unsupported method
+func MethodNotAllowedServer(w http.ResponseWriter, req *http.Request) {
+	HandleProblem(w, req, newProblem(http.StatusMethodNotAllowed, problemBlank, req.Method+" is not supported for "+req.URL.Path))
 }
 
-// GetStatus Returns the extended application status
-func GetStatus(w http.ResponseWriter, req *http.Request) {
-	HandleResponse(w, "200 OK", http.StatusOK)
+// HomeServer Basic status and root handler
+func HomeServer(w http.ResponseWriter, req *http.Request) {
+	HandleResponse(w, req, "200 OK", http.StatusOK)
 }
 
 // Teapot Easter Egg teapot 418 handler
 func Teapot(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("X-Teapot", "Chai")
-	HandleResponse(w, "Are you a teapot?", http.StatusTeapot)
+	HandleProblem(w, req, newProblem(http.StatusTeapot, problemBlank, "Are you a teapot?"))
 }
 
 // GetRoutes Returns a listing of all routes
 func GetRoutes(w http.ResponseWriter, req *http.Request) {
-	HandleResponse(w, App.Router.Routes, http.StatusOK)
-}
-
-// nextRequestID Use unix timestamp
-func nextRequestID() string {
-	return strconv.FormatInt(time.Now().UnixNano(), 36)
+	HandleResponse(w, req, App.Router.Routes, http.StatusOK)
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// feedHealth Tracks the outcome of upstream fetches for /status, /readyz and metrics
+type feedHealth struct {
+	mu                  sync.RWMutex
+	loadedAt            time.Time
+	stations            int
+	lastError           string
+	lastErrorAt         time.Time
+	consecutiveFailures int
+}
+
+// feed The health of the CitiBike feed
+var feed feedHealth
+
+// succeeded Record a successful upstream fetch
+func (f *feedHealth) succeeded() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loadedAt = time.Now()
+	f.consecutiveFailures = 0
+}
+
+// failed Record a failed upstream fetch
+func (f *feedHealth) failed(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastError = err.Error()
+	f.lastErrorAt = time.Now()
+	f.consecutiveFailures++
+}
+
+// setStations Record the number of stations in the current snapshot
+func (f *feedHealth) setStations(count int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stations = count
+}
+
+// ready True once the feed has been loaded successfully at least once
+func (f *feedHealth) ready() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return !f.loadedAt.IsZero()
+}
+
+// lastLoaded When the feed was last fetched successfully, zero if never
+func (f *feedHealth) lastLoaded() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.loadedAt
+}
+
+// age Time since the last successful fetch, -1 if never
+func (f *feedHealth) age() time.Duration {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.loadedAt.IsZero() {
+		return -1
+	}
+	return time.Since(f.loadedAt)
+}
+
+// Status The extended application status served on /status
+type Status struct {
+	Name          string         `json:"name"`
+	Version       string         `json:"version"`
+	ID            string         `json:"id"`
+	Started       string         `json:"started"`
+	Uptime        string         `json:"uptime"`
+	UptimeSeconds float64        `json:"uptimeSeconds"`
+	Ready         bool           `json:"ready"`
+	Snapshot      SnapshotStatus `json:"snapshot"`
+	Upstream      UpstreamStatus `json:"upstream"`
+	Redis         RedisStatus    `json:"redis"`
+	Cache         CacheStatus    `json:"cache"`
+	Runtime       RuntimeStatus  `json:"runtime"`
+}
+
+// SnapshotStatus The currently loaded CitiBike snapshot
+type SnapshotStatus struct {
+	LoadedAt   string  `json:"loadedAt,omitempty"`
+	AgeSeconds float64 `json:"ageSeconds"`
+	Stations   int     `json:"stations"`
+}
+
+// UpstreamStatus Health of the CitiBike feed
+type UpstreamStatus struct {
+	URL                 string `json:"url"`
+	Healthy             bool   `json:"healthy"`
+	LastError           string `json:"lastError,omitempty"`
+	LastErrorAt         string `json:"lastErrorAt,omitempty"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+}
+
+// RedisStatus Result of pinging Redis, if configured
+type RedisStatus struct {
+	Enabled bool   `json:"enabled"`
+	Ping    string `json:"ping,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CacheStatus Hit and miss counts for BigCache and http-cache
+type CacheStatus struct {
+	BigCacheEntries    int   `json:"bigcacheEntries"`
+	BigCacheHits       int64 `json:"bigcacheHits"`
+	BigCacheMisses     int64 `json:"bigcacheMisses"`
+	BigCacheCollisions int64 `json:"bigcacheCollisions"`
+	HTTPCacheHits      int64 `json:"httpCacheHits"`
+	HTTPCacheMisses    int64 `json:"httpCacheMisses"`
+}
+
+// RuntimeStatus Go runtime statistics
+type RuntimeStatus struct {
+	GoVersion  string `json:"goVersion"`
+	Goroutines int    `json:"goroutines"`
+	NumCPU     int    `json:"numCPU"`
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	Sys        uint64 `json:"sys"`
+	NumGC      uint32 `json:"numGC"`
+}
+
+// GetStatus Returns the extended application status
+func GetStatus(w http.ResponseWriter, req *http.Request) {
+	status := Status{
+		Name:    App.Name,
+		Version: App.Version,
+		ID:      App.ID,
+		Started: App.Runtime,
+		Ready:   feed.ready(),
+	}
+
+	if started, err := time.Parse(time.RFC3339, App.Runtime); err == nil {
+		uptime := time.Since(started)
+		status.Uptime = uptime.Round(time.Second).String()
+		status.UptimeSeconds = uptime.Seconds()
+	}
+
+	feed.mu.RLock()
+	if !feed.loadedAt.IsZero() {
+		status.Snapshot.LoadedAt = feed.loadedAt.UTC().Format(time.RFC3339)
+	}
+	status.Snapshot.Stations = feed.stations
+	status.Upstream = UpstreamStatus{
+		URL:                 currentConfig().Feed.URL,
+		Healthy:             feed.consecutiveFailures == 0,
+		LastError:           feed.lastError,
+		ConsecutiveFailures: feed.consecutiveFailures,
+	}
+	if !feed.lastErrorAt.IsZero() {
+		status.Upstream.LastErrorAt = feed.lastErrorAt.UTC().Format(time.RFC3339)
+	}
+	feed.mu.RUnlock()
+	status.Snapshot.AgeSeconds = feedAgeSeconds()
+
+	if App.Redis != nil {
+		status.Redis.Enabled = true
+		pong, err := App.Redis.Ping().Result()
+		status.Redis.Ping = pong
+		if err != nil {
+			status.Redis.Error = err.Error()
+		}
+	}
+
+	if App.Cache != nil {
+		stats := App.Cache.Stats()
+		status.Cache.BigCacheEntries = App.Cache.Len()
+		status.Cache.BigCacheHits = stats.Hits
+		status.Cache.BigCacheMisses = stats.Misses
+		status.Cache.BigCacheCollisions = stats.Collisions
+	}
+	status.Cache.HTTPCacheHits, status.Cache.HTTPCacheMisses = httpCacheStats()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	status.Runtime = RuntimeStatus{
+		GoVersion:  runtime.Version(),
+		Goroutines: runtime.NumGoroutine(),
+		NumCPU:     runtime.NumCPU(),
+		HeapAlloc:  mem.HeapAlloc,
+		Sys:        mem.Sys,
+		NumGC:      mem.NumGC,
+	}
+
+	HandleResponse(w, req, status, http.StatusOK)
+}
+
+// GetHealthz Liveness probe; the process is serving requests
+func GetHealthz(w http.ResponseWriter, req *http.Request) {
+	HandleResponse(w, req, "200 OK", http.StatusOK)
+}
+
+// GetReadyz Readiness probe; fails until the feed has been loaded once
+func GetReadyz(w http.ResponseWriter, req *http.Request) {
+	if !feed.ready() {
+		HandleProblem(w, req, newProblem(http.StatusServiceUnavailable, problemNotReady, "The CitiBike feed has not been loaded yet"))
+		return
+	}
+	HandleResponse(w, req, "200 OK", http.StatusOK)
+}
+
+// warmFeed Load the feed in the background at startup, retrying with backoff,
+// so that readiness doesn't depend on the first client request
+func warmFeed(ctx context.Context) {
+	backoff := time.Second
+	for {
+		var stations Stations
+		stations.getJSON(ctx)
+		if feed.ready() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < time.Minute {
+			backoff *= 2
+		}
+	}
+}
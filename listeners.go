@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gorilla/mux"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultListener The listener set up by SRV_NETWORK, SRV_ADDRESS and SRV_PORT. It serves
+// every route which doesn't name another configured listener
+const defaultListener = "default"
+
+// Listeners outside SRV_LISTENERS, after the HTTP ones, so they are handed to a process
+// started by SIGUSR2 with them: the HTTPS redirect and the gRPC server
+const (
+	redirectListener = "redirect"
+	grpcListener     = "grpc"
+)
+
+// listenerName The names SRV_LISTENERS may give its listeners
+var listenerName = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// ListenerConfig A socket the server accepts connections on
+type ListenerConfig struct {
+	Name    string
+	Network string
+	Address string
+}
+
+// listeners The default listener followed by those in SRV_LISTENERS, which are comma
+// separated as name=network:address, e.g. "admin=tcp:127.0.0.1:4002,api=unix:/run/nbc.sock"
+func (c ServerConfig) listeners() ([]ListenerConfig, error) {
+	address := c.Address
+	if c.Network == "tcp" {
+		address = net.JoinHostPort(c.Address, c.Port)
+	}
+	listeners := []ListenerConfig{{Name: defaultListener, Network: c.Network, Address: address}}
+
+	names := map[string]bool{defaultListener: true}
+	for _, entry := range splitList(c.Listeners) {
+		name, spec, ok := strings.Cut(entry, "=")
+		network, address, _ := strings.Cut(spec, ":")
+		switch {
+		case !ok || address == "":
+			return nil, fmt.Errorf("%q is not name=network:address", entry)
+		case !listenerName.MatchString(name):
+			return nil, fmt.Errorf("%q has an invalid name", entry)
+		case name == redirectListener || name == grpcListener:
+			return nil, fmt.Errorf("listener name %q is reserved", name)
+		case names[name]:
+			return nil, fmt.Errorf("listener %q is defined more than once", name)
+		case network != "tcp" && network != "unix":
+			return nil, fmt.Errorf("%q has network %q, not tcp or unix", entry, network)
+		}
+		if network == "tcp" {
+			if _, _, err := net.SplitHostPort(address); err != nil {
+				return nil, fmt.Errorf("%q: %s", entry, err)
+			}
+		}
+		names[name] = true
+		listeners = append(listeners, ListenerConfig{Name: name, Network: network, Address: address})
+	}
+	return listeners, nil
+}
+
+// removeStaleSocket Remove the unix socket at path if it was left behind by a process
+// which is no longer listening on it. A live socket is left for net.Listen to refuse
+func removeStaleSocket(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return
+	}
+	Logger.Write(fmt.Sprintf("Removing stale socket %s", path))
+	os.Remove(path)
+}
+
+// routeTable The routes served on one listener, with a subrouter per API version
+type routeTable struct {
+	router   *mux.Router
+	versions map[string]*mux.Router
+}
+
+// newRouteTable An empty table answering unknown paths and methods with problems
+func newRouteTable() *routeTable {
+	router := mux.NewRouter().StrictSlash(false)
+	router.NotFoundHandler = traceRequest(requestID(logRequest(http.HandlerFunc(NotFoundServer), "NotFound")), "NotFound")
+	router.MethodNotAllowedHandler = traceRequest(requestID(logRequest(http.HandlerFunc(MethodNotAllowedServer), "MethodNotAllowed")), "MethodNotAllowed")
+
+	table := &routeTable{router: router, versions: make(map[string]*mux.Router)}
+	for _, version := range apiVersions {
+		table.versions[version] = router.PathPrefix("/" + version).Subrouter()
+	}
+	return table
+}
+
+// routerFor The router serving route and its path there: versioned routes are served
+// by their version's subrouter
+func (T *routeTable) routerFor(route Route) (*mux.Router, string) {
+	if route.Version != "" {
+		return T.versions[route.Version], strings.TrimPrefix(route.URI, "/"+route.Version)
+	}
+	return T.router, route.URI
+}
+
+// servedOn The listeners serving route: the configured ones it names, or the default
+// listener if it names none of them
+func (R *Router) servedOn(route Route) []string {
+	var names []string
+	for _, name := range route.Listeners {
+		if R.tables[name] != nil && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return []string{defaultListener}
+	}
+	return names
+}
+
+// handler The routes served on the listener called name
+func (R *Router) handler(name string) http.Handler {
+	return R.tables[name].router
+}
@@ -1,14 +1,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/allegro/bigcache"
 	"github.com/go-redis/redis"
 	"github.com/sphireco/mantis"
-	"github.com/subosito/gotenv"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
 	"net/http"
 	"os"
-	"strconv"
 	"time"
 )
 
@@ -26,6 +27,14 @@ type Application struct {
 	Redis    *redis.Client      `json:"redis"`
 	Database string             `json:"database"`
 	Emailer  string             `json:"emailer"`
+
+	AccessLog  *accessLogger  `json:"-"`
+	Config     *Config        `json:"-"`
+	GRPC       *grpc.Server   `json:"-"`
+	GRPCHealth *health.Server `json:"-"`
+
+	// ShutdownTracing flushes the spans still batched for export
+	ShutdownTracing func(context.Context) error `json:"-"`
 }
 
 // Server Defines our core Server
@@ -35,6 +44,8 @@ type Server struct {
 	WriteTimeout time.Duration `json:"write_timeout"`
 	ReadTimeout  time.Duration `json:"read_timeout"`
 	MemCacheTime time.Duration `json:"mem_cache_time"`
+
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"`
 }
 
 // App The Core Application Definitions
@@ -43,40 +54,28 @@ var App Application
 // Logger The main logging interface
 var Logger mantis.Log
 
-func init() {
-	err := gotenv.Load()
-	if err != nil {
-		panic(err)
-	}
-
-	writeTimeout, err1 := strconv.Atoi(os.Getenv("SRV_WRITE_TIMEOUT"))
-	readTimeout, err2 := strconv.Atoi(os.Getenv("SRV_READ_TIMEOUT"))
-	memCacheTime, err3 := strconv.Atoi(os.Getenv("SRV_MEMCACHE_TIME_MINUTES"))
-
-	// Set default values if atoi fails
-	if err1 != nil || err2 != nil || err3 != nil {
-		writeTimeout = 30
-		readTimeout = 30
-		memCacheTime = 30
-	}
-
+// setup Build the application from cfg
+func setup(cfg *Config) {
 	App = Application{
-		Name:    os.Getenv("APP_NAME"),
-		ID:      os.Getenv("APP_ID"),
-		Version: os.Getenv("APP_VERSION"),
-		Log:     os.Getenv("LOG_LOCATION"),
+		Name:    cfg.App.Name,
+		ID:      cfg.App.ID,
+		Version: cfg.App.Version,
+		Log:     cfg.Log.Location,
 		Server: Server{
-			Address:      os.Getenv("SRV_ADDRESS"),
-			Port:         os.Getenv("SRV_PORT"),
-			WriteTimeout: time.Duration(writeTimeout),
-			ReadTimeout:  time.Duration(readTimeout),
-			MemCacheTime: time.Duration(memCacheTime),
+			Address:      cfg.Server.Address,
+			Port:         cfg.Server.Port,
+			WriteTimeout: cfg.Server.WriteTimeout,
+			ReadTimeout:  cfg.Server.ReadTimeout,
+			MemCacheTime: cfg.Server.MemCacheTime,
+
+			ShutdownTimeout: cfg.Server.ShutdownTimeout,
 		},
 		Runtime: time.Now().UTC().Format(time.RFC3339),
+		Config:  cfg,
 	}
 
-	if len(os.Getenv("REDIS_ADDRESS")) > 0 {
-		App.Redis = setupRedis()
+	if len(cfg.Redis.Address) > 0 {
+		App.Redis = setupRedis(cfg.Redis)
 	}
 
 	config := bigcache.Config{
@@ -87,60 +86,100 @@ func init() {
 		Verbose:            true,
 		HardMaxCacheSize:   64,
 	}
+	var err error
 	App.Cache, err = bigcache.NewBigCache(config)
 	mantis.HandleFatalError(err)
 
 	Logger.NewLog(App.Log)
 	mantis.SetErrorLog(Logger)
 
+	App.AccessLog, err = newAccessLogger(cfg.Log.AccessLocation, cfg.Log.MaxSizeMB, cfg.Log.MaxBackups, cfg.Log.AccessSampleRate)
+	mantis.HandleError("setup:newAccessLogger", err)
+
 	Logger.Write(fmt.Sprintf("Initializing %s %s @ %s", App.Name, App.Version, App.Runtime))
 	Logger.Write(App.ID + "\n")
 }
 
 func main() {
-	App.Router.Load()
-	srv := &http.Server{
-		Handler:      App.Router.router,
-		Addr:         fmt.Sprintf("%s:%s", App.Server.Address, App.Server.Port),
-		WriteTimeout: App.Server.WriteTimeout * time.Second,
-		ReadTimeout:  App.Server.ReadTimeout * time.Second,
+	cfg, args, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	mantis.HandleError("ListenAndServe", srv.ListenAndServe())
-}
+	if len(args) > 0 {
+		if len(args) != 2 || args[0] != "config" || args[1] != "print" {
+			fmt.Fprintln(os.Stderr, errConfigCommand)
+			os.Exit(2)
+		}
+		cfg.Print(os.Stdout)
+		return
+	}
 
-func setupRedis() *redis.Client {
-	readTimeout, err := strconv.Atoi(os.Getenv("REDIS_READ_TIMEOUT"))
-	mantis.HandleFatalError(err)
-	writeTimeout, err := strconv.Atoi(os.Getenv("REDIS_WRITE_TIMEOUT"))
-	mantis.HandleFatalError(err)
-	db, err := strconv.Atoi(os.Getenv("REDIS_DB"))
-	mantis.HandleFatalError(err)
-	maxRetries, err := strconv.Atoi(os.Getenv("REDIS_MAX_RETRIES"))
-	mantis.HandleFatalError(err)
-	minRetryBackoff, err := strconv.Atoi(os.Getenv("REDIS_MIN_RETRY_BACKOFF"))
-	mantis.HandleFatalError(err)
-	maxRetryBackoff, err := strconv.Atoi(os.Getenv("REDIS_MAX_RETRY_BACKOFF"))
-	mantis.HandleFatalError(err)
-	dialTimeout, err := strconv.Atoi(os.Getenv("REDIS_DIAL_TIMEOUT"))
-	mantis.HandleFatalError(err)
-	poolSize, err := strconv.Atoi(os.Getenv("REDIS_POOL_SIZE"))
+	setup(cfg)
+	mantis.HandleFatalError(applyConfig(cfg))
+
+	App.ShutdownTracing, err = setupTracing(context.Background(), cfg.Trace)
 	mantis.HandleFatalError(err)
-	minIdleConns, err := strconv.Atoi(os.Getenv("REDIS_MIN_IDLE_CONNS"))
+
+	mantis.HandleFatalError(App.Router.Load())
+	go warmFeed(background)
+	if cfg.Server.WatchConfig {
+		go watchConfig(background, os.Args[1:])
+	}
+
+	// Each listener gets its own server, serving the routes assigned to it
+	listeners, err := cfg.Server.listeners()
 	mantis.HandleFatalError(err)
+	var certs *certificates
+	if cfg.TLS.enabled() {
+		certs, err = loadCertificates(cfg.TLS)
+		mantis.HandleFatalError(err)
+		go watchCertificates(background, certs)
+	}
+	servers := make([]*http.Server, 0, len(listeners))
+	for _, listener := range listeners {
+		server := &http.Server{
+			Handler:      App.Router.handler(listener.Name),
+			Addr:         listener.Address,
+			WriteTimeout: App.Server.WriteTimeout,
+			ReadTimeout:  App.Server.ReadTimeout,
+		}
+		// Unix sockets are local, so they are served in the clear
+		if certs != nil && listener.Network == "tcp" {
+			server.TLSConfig = certs.serverConfig()
+		}
+		servers = append(servers, server)
+	}
+	// The redirect server is served, handed off and drained like the others
+	if redirect := newRedirectServer(cfg); redirect != nil {
+		servers = append(servers, redirect)
+		listeners = append(listeners, ListenerConfig{Name: redirectListener, Network: "tcp", Address: redirect.Addr})
+	}
+
+	// The gRPC server runs on its own port and is drained by shutdown
+	if cfg.GRPC.Port != "" {
+		App.GRPC, App.GRPCHealth = newGRPCServer(cfg.GRPC)
+		listeners = append(listeners, ListenerConfig{Name: grpcListener, Network: "tcp", Address: grpcAddress(cfg.GRPC)})
+	}
+
+	mantis.HandleError("serve", serve(servers, listeners))
+}
 
+func setupRedis(cfg RedisConfig) *redis.Client {
 	client := redis.NewClient(&redis.Options{
-		Addr:            os.Getenv("REDIS_ADDRESS"),
-		Password:        os.Getenv("REDIS_PASSWORD"),
-		DB:              db,
-		MaxRetries:      maxRetries,
-		MinRetryBackoff: time.Duration(minRetryBackoff),
-		MaxRetryBackoff: time.Duration(maxRetryBackoff),
-		DialTimeout:     time.Duration(dialTimeout),
-		ReadTimeout:     time.Duration(readTimeout) * time.Second,
-		WriteTimeout:    time.Duration(writeTimeout) * time.Second,
-		PoolSize:        poolSize,
-		MinIdleConns:    minIdleConns,
+		Network:         cfg.Network,
+		Addr:            cfg.Address,
+		Password:        cfg.Password,
+		DB:              cfg.DB,
+		MaxRetries:      cfg.MaxRetries,
+		MinRetryBackoff: cfg.MinRetryBackoff,
+		MaxRetryBackoff: cfg.MaxRetryBackoff,
+		DialTimeout:     cfg.DialTimeout,
+		ReadTimeout:     cfg.ReadTimeout,
+		WriteTimeout:    cfg.WriteTimeout,
+		PoolSize:        cfg.PoolSize,
+		MinIdleConns:    cfg.MinIdleConns,
 	})
 
 	pong, err := client.Ping().Result()
@@ -1,43 +1,94 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"github.com/allegro/bigcache"
+	"github.com/andybalholm/brotli"
 	"github.com/gorilla/mux"
+	"github.com/jsanc623/NBC/client"
+	"github.com/jsanc623/NBC/pb"
+	"github.com/sphireco/mantis"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func executeRequestViaRecorder(req *http.Request) *httptest.ResponseRecorder {
 	httpTestRecorder := httptest.NewRecorder()
+	setupTestApp()
 
+	App.Router.router.ServeHTTP(httpTestRecorder, req)
+
+	mux.NewRouter().ServeHTTP(httpTestRecorder, req)
+	return httpTestRecorder
+}
+
+// executeFixtureRequest Serves req with the feed preloaded from testdata/stations.json
+func executeFixtureRequest(req *http.Request) *httptest.ResponseRecorder {
+	httpTestRecorder := httptest.NewRecorder()
+	setupTestApp()
+
+	fixture, _ := ioutil.ReadFile("testdata/stations.json")
+	App.Cache.Set(feedCacheKey, fixture)
+
+	App.Router.router.ServeHTTP(httpTestRecorder, req)
+	return httpTestRecorder
+}
+
+func setupTestApp() {
+	cfg, _, _ := loadConfig(nil)
 	App = Application{
-		Name:    os.Getenv("APP_NAME"),
-		ID:      os.Getenv("APP_ID"),
-		Version: os.Getenv("APP_VERSION"),
-		Log:     os.Getenv("LOG_LOCATION"),
+		Name:    cfg.App.Name,
+		ID:      cfg.App.ID,
+		Version: cfg.App.Version,
+		Log:     cfg.Log.Location,
 		Server: Server{
-			Address:      os.Getenv("SRV_ADDRESS"),
-			Port:         os.Getenv("SRV_PORT"),
-			WriteTimeout: time.Duration(10),
-			ReadTimeout:  time.Duration(10),
-			MemCacheTime: time.Duration(10),
+			Address:      cfg.Server.Address,
+			Port:         cfg.Server.Port,
+			WriteTimeout: 10 * time.Second,
+			ReadTimeout:  10 * time.Second,
+			MemCacheTime: 10 * time.Minute,
 		},
 		Runtime: time.Now().UTC().Format(time.RFC3339),
+		Config:  cfg,
 	}
 	App.Router.Load()
 	App.Cache, _ = bigcache.NewBigCache(bigcache.DefaultConfig(10 * time.Minute))
 	Logger.NewLog(App.Log)
-
-	App.Router.router.ServeHTTP(httpTestRecorder, req)
-
-	mux.NewRouter().ServeHTTP(httpTestRecorder, req)
-	return httpTestRecorder
 }
 
 // remove404 for some reason it appends "404 page not found" to end of JSON response during testing
@@ -64,7 +115,7 @@ func checkResponseCodeAndUnmarshalJSON(t *testing.T, expectedCode int, actualCod
 
 func TestStations(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/stations", nil)
-	response := executeRequestViaRecorder(req)
+	response := executeFixtureRequest(req)
 
 	checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), true)
 	body := response.Body.String()
@@ -75,7 +126,7 @@ func TestStations(t *testing.T) {
 
 func TestStationsPaged(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/stations?page=3", nil)
-	response := executeRequestViaRecorder(req)
+	response := executeFixtureRequest(req)
 
 	resp := checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), true)
 	if len(resp) > 20 {
@@ -128,16 +179,1530 @@ func TestInvalidPage(t *testing.T) {
 
 func TestInvalidStationIdForDockable(t *testing.T) {
 	req, _ := http.NewRequest("GET", "/dockable/100000000000/100000000", nil)
+	response := executeFixtureRequest(req)
+
+	if response.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 Got %d", response.Code)
+	}
+	var problem Problem
+	err := json.Unmarshal(response.Body.Bytes(), &problem)
+	if err != nil {
+		t.Errorf("JSON Unmarshal failed: %s", err.Error())
+	}
+	if problem.Type != problemStationNotFound {
+		t.Errorf("Expected a station-not-found problem Got %s", problem.Type)
+	}
+}
+
+func TestRequestIDPropagated(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/teapot", nil)
+	req.Header.Set("X-Request-Id", "abc-123")
 	response := executeRequestViaRecorder(req)
 
-	checkResponseCodeAndUnmarshalJSON(t, http.StatusBadRequest, response.Code, response.Body.String(), false)
+	if id := response.Header().Get("X-Request-Id"); id != "abc-123" {
+		t.Errorf("Expected request ID abc-123 Got %s", id)
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/teapot", nil)
+	first := executeRequestViaRecorder(req).Header().Get("X-Request-Id")
+
+	req, _ = http.NewRequest("GET", "/teapot", nil)
+	second := executeRequestViaRecorder(req).Header().Get("X-Request-Id")
+
+	if len(first) != 32 || first == second {
+		t.Errorf("Expected unique generated request IDs Got %q and %q", first, second)
+	}
+}
 
-	var station BikesToReturn
-	err := json.Unmarshal([]byte(remove404(response.Body.String())), &station)
+func TestSessionTokenIsRequestID(t *testing.T) {
+	setupTestApp()
+	// The second request is served by http-cache, which must not replay the first token
+	for _, id := range []string{"session-1", "session-2"} {
+		req, _ := http.NewRequest("GET", "/openapi.json", nil)
+		req.Header.Set("X-Request-Id", id)
+		response := httptest.NewRecorder()
+		App.Router.router.ServeHTTP(response, req)
+
+		if token := response.Header().Get("X-Session-Token"); token != id {
+			t.Errorf("Expected session token %s Got %s", id, token)
+		}
+	}
+}
+
+func TestAccessLogEntry(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "nbc")
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "access.log")
+
+	accessLog, err := newAccessLogger(logPath, 1, 1, 1)
 	if err != nil {
-		t.Errorf("JSON Unmarshal failed: %s", err.Error())
+		t.Fatalf("newAccessLogger failed: %s", err.Error())
+	}
+	defer accessLog.Close()
+
+	handler := requestID(logRequest(cacheLookup(cacheMiss(http.HandlerFunc(Teapot))), "Teapot"))
+	uncached := requestID(logRequest(http.HandlerFunc(Teapot), "Uncached"))
+	App.AccessLog = accessLog
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/teapot", nil))
+	uncached.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/teapot", nil))
+	App.AccessLog = nil
+
+	contents, _ := ioutil.ReadFile(logPath)
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	var entry, uncachedEntry accessLogEntry
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 access log entries Got %d", len(lines))
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("JSON Unmarshal failed: %s", err.Error())
+	}
+	if entry.Route != "Teapot" || entry.Status != http.StatusTeapot || entry.Cache != "miss" ||
+		entry.Bytes == 0 || entry.RequestID == "" {
+		t.Errorf("Unexpected access log entry %+v", entry)
+	}
+	// A route without a cache neither hits nor misses it
+	json.Unmarshal([]byte(lines[1]), &uncachedEntry)
+	if uncachedEntry.Route != "Uncached" || uncachedEntry.Cache != "" || strings.Contains(lines[1], `"cache"`) {
+		t.Errorf("Expected no cache result for a route without a cache Got %s", lines[1])
+	}
+}
+
+func TestAccessLogRotation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "nbc")
+	defer os.RemoveAll(dir)
+	logPath := filepath.Join(dir, "access.log")
+
+	logger := Logger
+	t.Cleanup(func() {
+		Logger = logger
+		mantis.SetErrorLog(Logger)
+	})
+
+	accessLog, _ := newAccessLogger(logPath, 0, 2, 1)
+	defer accessLog.Close()
+	accessLog.maxSize = 200
+
+	for i := 0; i < 10; i++ {
+		accessLog.Write(accessLogEntry{Route: "Rotate", Status: http.StatusOK})
+	}
+
+	if _, err := os.Stat(logPath + ".2"); err != nil {
+		t.Errorf("Expected two rotated files: %s", err.Error())
+	}
+	if _, err := os.Stat(logPath + ".3"); err == nil {
+		t.Errorf("Expected at most two rotated files")
+	}
+	// Rotating the access log leaves the application log where it was
+	if !reflect.DeepEqual(Logger, logger) {
+		t.Errorf("Expected the application log to be unchanged by rotation Got %+v", Logger)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/teapot", nil)
+	executeRequestViaRecorder(req)
+
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	response := executeRequestViaRecorder(req)
+
+	checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), false)
+	body := response.Body.String()
+	for _, metric := range []string{`nbc_http_requests_total{route="Teapot",status="418"}`,
+		`nbc_cache_hit_ratio{cache="bigcache"}`, "nbc_snapshot_age_seconds"} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("Expected metric %s in /metrics output", metric)
+		}
+	}
+
+	// Only routes with a cache count http-cache hits and misses
+	hits, misses := httpCacheStats()
+	for i := 0; i < 2; i++ {
+		App.Router.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+		App.Router.router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/openapi.json", nil))
+	}
+	if newHits, newMisses := httpCacheStats(); newHits-hits != 1 || newMisses-misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss Got %d and %d", newHits-hits, newMisses-misses)
+	}
+}
+
+func TestTraceparentPropagated(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+
+	req, _ := http.NewRequest("GET", "/teapot", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	executeRequestViaRecorder(req)
+
+	names := make(map[string]bool)
+	for _, span := range spans.Ended() {
+		names[span.Name()] = true
+		if traceID := span.SpanContext().TraceID().String(); traceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("Span %s has trace ID %s", span.Name(), traceID)
+		}
+	}
+	for _, name := range []string{"Teapot", "logRequest", "recoverPanic", "http-cache", "cors", "handler"} {
+		if !names[name] {
+			t.Errorf("Expected a %s span", name)
+		}
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/healthz", nil)
+	response := executeRequestViaRecorder(req)
+
+	checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), false)
+}
+
+func TestReadyzAfterFeedLoad(t *testing.T) {
+	feed = feedHealth{}
+	req, _ := http.NewRequest("GET", "/readyz", nil)
+	response := executeRequestViaRecorder(req)
+	checkResponseCodeAndUnmarshalJSON(t, http.StatusServiceUnavailable, response.Code, response.Body.String(), false)
+
+	feed.succeeded()
+	defer func() { feed = feedHealth{} }()
+	req, _ = http.NewRequest("GET", "/readyz", nil)
+	response = executeRequestViaRecorder(req)
+	checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), false)
+}
+
+func TestStatus(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/status", nil)
+	response := executeRequestViaRecorder(req)
+
+	checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), false)
+	var status Status
+	if err := json.Unmarshal([]byte(remove404(response.Body.String())), &status); err != nil {
+		t.Fatalf("JSON Unmarshal failed: %s", err.Error())
+	}
+	if status.Started != App.Runtime || status.Runtime.Goroutines == 0 || status.Upstream.URL == "" {
+		t.Errorf("Unexpected status %+v", status)
+	}
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	started := make(chan bool)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	})}
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	go srv.Serve(listener)
+
+	result := make(chan int)
+	go func() {
+		res, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			result <- 0
+			return
+		}
+		result <- res.StatusCode
+	}()
+
+	<-started
+	App.Server.ShutdownTimeout = 5 * time.Second
+	flushed := false
+	App.ShutdownTracing = func(ctx context.Context) error {
+		_, bounded := ctx.Deadline()
+		flushed = bounded
+		return nil
+	}
+	defer func() { App.ShutdownTracing = nil }()
+	if err := shutdown(srv); err != nil {
+		t.Errorf("Shutdown failed: %s", err.Error())
+	}
+	if !flushed {
+		t.Error("Expected traces to be flushed within the shutdown timeout before shutdown returned")
+	}
+	if status := <-result; status != http.StatusOK {
+		t.Errorf("Expected in-flight request to complete Got %d", status)
+	}
+}
+
+func TestConfigLayering(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "nbc")
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	ioutil.WriteFile("nbc.yaml", []byte("server:\n  port: 5000\n  read_timeout: 7s\nlog:\n  max_backups: 2\n"), 0644)
+	ioutil.WriteFile(".env", []byte("SRV_READ_TIMEOUT=5\n"), 0644)
+
+	os.Setenv("SRV_PORT", "6000")
+	defer os.Unsetenv("SRV_PORT")
+
+	cfg, args, err := loadConfig([]string{"-config", "nbc.yaml", "config", "print", "-server.port=7000"})
+	if err != nil {
+		t.Fatalf("loadConfig failed: %s", err.Error())
+	}
+	if len(args) != 2 || args[0] != "config" || args[1] != "print" {
+		t.Errorf("Expected positional args [config print] Got %v", args)
+	}
+	if cfg.Server.Port != "7000" {
+		t.Errorf("Expected flag to win Got port %s", cfg.Server.Port)
+	}
+	if cfg.Server.ReadTimeout != 5*time.Second {
+		t.Errorf("Expected .env to override config file Got read timeout %s", cfg.Server.ReadTimeout)
+	}
+	if cfg.Log.MaxBackups != 2 || cfg.Log.MaxSizeMB != 100 {
+		t.Errorf("Expected config file and defaults Got %+v", cfg.Log)
+	}
+}
+
+func TestConfigReportsAllProblems(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "nbc")
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	ioutil.WriteFile(".env", []byte("SRV_READ_TiMEOUT=5\nSRV_WRITE_TIMEOUT=soon\nSRV_PORT=99999\nACCESS_LOG_LOCATION=nbc.log\n"), 0644)
+
+	_, _, err := loadConfig(nil)
+	problems, ok := err.(ConfigErrors)
+	if !ok || len(problems) != 4 {
+		t.Fatalf("Expected four problems Got %v", err)
+	}
+	if !strings.Contains(err.Error(), "did you mean SRV_READ_TIMEOUT?") {
+		t.Errorf("Expected a suggestion for the misspelt key Got %s", err.Error())
+	}
+	if !strings.Contains(err.Error(), "ACCESS_LOG_LOCATION") {
+		t.Errorf("Expected the access log to be kept apart from the log Got %s", err.Error())
+	}
+}
+
+func TestConfigPrintRedactsSecrets(t *testing.T) {
+	os.Setenv("REDIS_PASSWORD", "hunter2")
+	defer os.Unsetenv("REDIS_PASSWORD")
+
+	cfg, _, err := loadConfig(nil)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %s", err.Error())
+	}
+
+	var out strings.Builder
+	cfg.Print(&out)
+	if strings.Contains(out.String(), "hunter2") || !strings.Contains(out.String(), "[redacted]") {
+		t.Errorf("Expected REDIS_PASSWORD to be redacted Got:\n%s", out.String())
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "nbc")
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+	defer liveConfig.Store(defaultConfig())
+
+	ioutil.WriteFile(".env", []byte("LOG_LEVEL=info\nSRV_PORT=4000\n"), 0644)
+	cfg, _, _ := loadConfig(nil)
+	App.Router.startCache()
+	applyConfig(cfg)
+
+	ioutil.WriteFile(".env", []byte("LOG_LEVEL=debug\nSRV_PORT=5000\nFEED_URL=http://127.0.0.1/feed\n"), 0644)
+	if err := reloadConfig(nil); err != nil {
+		t.Fatalf("reloadConfig failed: %s", err.Error())
+	}
+
+	reloaded := currentConfig()
+	if reloaded.Log.Level != "debug" || !logEnabled(levelDebug) || reloaded.Feed.URL != "http://127.0.0.1/feed" {
+		t.Errorf("Expected live settings to be applied Got %+v %+v", reloaded.Log, reloaded.Feed)
+	}
+	if reloaded.Server.Port != "4000" {
+		t.Errorf("Expected port to need a restart Got %s", reloaded.Server.Port)
+	}
+
+	ioutil.WriteFile(".env", []byte("LOG_LEVEL=loud\n"), 0644)
+	if err := reloadConfig(nil); err == nil || currentConfig().Log.Level != "debug" {
+		t.Errorf("Expected invalid reload to be rejected")
+	}
+	atomic.StoreInt32(&logLevel, levelInfo)
+}
+
+func TestRoutesFileValidation(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "nbc")
+	defer os.RemoveAll(dir)
+	routesFile := filepath.Join(dir, "routes.yaml")
+	ioutil.WriteFile(routesFile, []byte(`
+- name: Bad
+  method: GET
+  uri: /bad
+  handler: NoSuchHandler
+  middleware: [noSuchMiddleware]
+- name: Cached
+  method: GET
+  uri: /cached
+  handler: Teapot
+  cache_ttl: 5s
+`), 0644)
+
+	var router Router
+	router.registerMiddleWare()
+	_, err := router.loadRoutes(routesFile)
+	problems, ok := err.(ConfigErrors)
+	if !ok || len(problems) != 2 {
+		t.Fatalf("Expected two problems Got %v", err)
+	}
+	if !strings.Contains(err.Error(), `unknown handler "NoSuchHandler"`) ||
+		!strings.Contains(err.Error(), `unknown middleware "noSuchMiddleware"`) {
+		t.Errorf("Unexpected problems %s", err.Error())
+	}
+}
+
+func TestVersionedStations(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v2/stations/in-service", nil)
+	response := executeFixtureRequest(req)
+
+	checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), false)
+	var page StationPage
+	if err := json.Unmarshal(response.Body.Bytes(), &page); err != nil {
+		t.Fatalf("JSON Unmarshal failed: %s", err.Error())
+	}
+	stations := page.Stations
+	if len(stations) != 4 || page.Total != 4 || stations[0].ID != 72 || !stations[0].Status.InService || stations[0].Location.Latitude == 0 {
+		t.Errorf("Unexpected v2 stations %+v", stations)
+	}
+	if response.Header().Get("Deprecation") != "" {
+		t.Errorf("Expected v2 not to be deprecated")
+	}
+}
+
+func TestUnversionedAliasDeprecated(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/stations/in-service", nil)
+	response := executeFixtureRequest(req)
+
+	resp := checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), true)
+	if len(resp) != 4 {
+		t.Errorf("Expected 4 stations Got %d", len(resp))
+	}
+	if response.Header().Get("Deprecation") != "true" || response.Header().Get("Sunset") == "" ||
+		response.Header().Get("Link") != `</v1/stations/in-service>; rel="successor-version"` {
+		t.Errorf("Expected deprecation headers Got %v", response.Header())
+	}
+
+	// Page links are added alongside the successor link, whether http-cache ran the
+	// route or replayed its response
+	req, _ = http.NewRequest("GET", "/stations?page=1&perPage=2", nil)
+	response = executeFixtureRequest(req)
+	cached := httptest.NewRecorder()
+	App.Router.router.ServeHTTP(cached, req)
+	for _, response := range []*httptest.ResponseRecorder{response, cached} {
+		links := response.Header().Values("Link")
+		if len(links) != 2 || links[1] != `</v1/stations>; rel="successor-version"` ||
+			!strings.Contains(links[0], `</stations?page=2&perPage=2>; rel="next"`) {
+			t.Errorf("Expected page and successor links Got %v", links)
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/v1/stations/in-service", nil)
+	response = executeFixtureRequest(req)
+	resp = checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), true)
+	if len(resp) != 4 || response.Header().Get("Deprecation") != "" {
+		t.Errorf("Expected v1 to match the alias without deprecation")
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	response := executeFixtureRequest(req)
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected 200 Got %d", response.Code)
+	}
+
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(response.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.OpenAPI != "3.0.3" || spec.Paths["/v1/stations"]["get"] == nil {
+		t.Errorf("Expected /v1/stations to be documented Got %v", spec.Paths)
+	}
+	if spec.Paths["/stations"]["get"]["deprecated"] != true {
+		t.Errorf("Expected the unversioned alias to be deprecated")
+	}
+	if spec.Paths["/v2/dockable/{stationId}/{bikesToReturn}"]["get"] == nil {
+		t.Errorf("Expected path parameters to be documented")
+	}
+	for _, schema := range []string{"ShortStation", "StationDetail", "BikesToReturn"} {
+		if spec.Components.Schemas[schema] == nil {
+			t.Errorf("Expected schema %s", schema)
+		}
+	}
+
+	req, _ = http.NewRequest("GET", "/docs", nil)
+	response = executeFixtureRequest(req)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "/openapi.json") {
+		t.Errorf("Expected docs page Got %d", response.Code)
+	}
+}
+
+func TestClient(t *testing.T) {
+	setupTestApp()
+	fixture, _ := ioutil.ReadFile("testdata/stations.json")
+	App.Cache.Set(feedCacheKey, fixture)
+
+	// Fail the first request to exercise retries, and record what the client sends
+	var requests int32
+	var apiKey, requestID atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey.Store(r.Header.Get("X-Api-Key"))
+		requestID.Store(r.Header.Get("X-Request-Id"))
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		App.Router.router.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c, err := client.New(server.URL, client.WithAPIKey("secret"), client.WithPerPage(2),
+		client.WithRetries(1, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := client.WithRequestID(context.Background(), "client-request-1")
+	stations, err := c.ListStations(ctx).All()
+	if err != nil || len(stations) != 5 {
+		t.Fatalf("Expected 5 stations Got %d, %v", len(stations), err)
+	}
+	seen := make(map[string]bool)
+	for _, station := range stations {
+		if seen[station.StationName] {
+			t.Errorf("Expected each station once Got %s twice", station.StationName)
+		}
+		seen[station.StationName] = true
+	}
+	if apiKey.Load() != "secret" || requestID.Load() != "client-request-1" {
+		t.Errorf("Expected API key and request ID to be sent Got %v %v", apiKey.Load(), requestID.Load())
+	}
+
+	if inService, _ := c.InService(ctx).All(); len(inService) != 4 {
+		t.Errorf("Expected 4 in service Got %d", len(inService))
+	}
+	if found, _ := c.Search(ctx, "fort greene").All(); len(found) != 1 {
+		t.Errorf("Expected 1 search result Got %d", len(found))
+	}
+
+	dockable, err := c.Dockable(ctx, 79, 1)
+	if err != nil || dockable.Dockable {
+		t.Errorf("Expected station 79 to have no docks Got %v, %v", dockable, err)
+	}
+	dockable, err = c.Dockable(ctx, 72, 1)
+	if err != nil || !dockable.Dockable {
+		t.Errorf("Expected station 72 to be dockable Got %v, %v", dockable, err)
+	}
+
+	near, err := c.Near(ctx, 40.7112, -74.0002, 1000)
+	if err != nil || len(near) != 1 || near[0].ID != 82 {
+		t.Errorf("Expected station 82 nearby Got %v, %v", near, err)
+	}
+	if _, err = c.Near(ctx, 91, 0, 0); !client.IsBadRequest(err) {
+		t.Errorf("Expected a bad request error Got %v", err)
+	}
+}
+
+func TestProblemResponses(t *testing.T) {
+	cases := []struct {
+		uri, problemType string
+		status           int
+	}{
+		{"/nowhere", problemBlank, http.StatusNotFound},
+		{"/v1/dockable/abc/1", problemInvalidParameter, http.StatusBadRequest},
+		{"/v1/dockable/72/-1", problemInvalidParameter, http.StatusBadRequest},
+		{"/v2/stations/near?lat=north&lon=0", problemInvalidParameter, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.uri, nil)
+		req.Header.Set("X-Request-Id", "problem-1")
+		response := executeFixtureRequest(req)
+
+		var problem Problem
+		json.Unmarshal(response.Body.Bytes(), &problem)
+		if response.Code != c.status || problem.Status != c.status || problem.Type != c.problemType {
+			t.Errorf("%s: expected %d %s Got %d %+v", c.uri, c.status, c.problemType, response.Code, problem)
+		}
+		if response.Header().Get("Content-Type") != problemContentType {
+			t.Errorf("%s: expected %s Got %s", c.uri, problemContentType, response.Header().Get("Content-Type"))
+		}
+		if problem.RequestID != "problem-1" || problem.Instance != strings.Split(c.uri, "?")[0] {
+			t.Errorf("%s: expected request ID and instance Got %+v", c.uri, problem)
+		}
+	}
+
+	// No docks is an answer, not a client error
+	req, _ := http.NewRequest("GET", "/v1/dockable/79/1", nil)
+	response := executeFixtureRequest(req)
+	var dockable BikesToReturn
+	json.Unmarshal(response.Body.Bytes(), &dockable)
+	if response.Code != http.StatusOK || dockable.Dockable || dockable.Message != "No docks available" {
+		t.Errorf("Expected 200 with no docks Got %d %+v", response.Code, dockable)
+	}
+}
+
+func TestUpstreamFailureIsProblem(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+
+	previous := currentConfig()
+	defer liveConfig.Store(previous)
+	cfg := defaultConfig()
+	cfg.Feed.URL = upstream.URL
+	liveConfig.Store(cfg)
+
+	req, _ := http.NewRequest("GET", "/v1/stations", nil)
+	response := executeRequestViaRecorder(req)
+
+	var problem Problem
+	json.Unmarshal([]byte(remove404(response.Body.String())), &problem)
+	if response.Code != http.StatusBadGateway || problem.Type != problemUpstreamUnavailable {
+		t.Errorf("Expected 502 upstream-unavailable Got %d %+v", response.Code, problem)
+	}
+}
+
+func TestRequestTimeoutCancelsUpstream(t *testing.T) {
+	cancelled := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(cancelled)
+	}))
+	defer upstream.Close()
+
+	previous := currentConfig()
+	defer liveConfig.Store(previous)
+	cfg := defaultConfig()
+	cfg.Feed.URL = upstream.URL
+	cfg.Server.RequestTimeout = 100 * time.Millisecond
+	liveConfig.Store(cfg)
+	App.Cache.Delete(feedCacheKey)
+
+	req, _ := http.NewRequest("GET", "/v1/stations", nil)
+	response := executeRequestViaRecorder(req)
+
+	var problem Problem
+	json.Unmarshal([]byte(remove404(response.Body.String())), &problem)
+	if response.Code != http.StatusGatewayTimeout || problem.Type != problemUpstreamTimeout {
+		t.Errorf("Expected 504 upstream-timeout Got %d %+v", response.Code, problem)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the upstream fetch to be cancelled")
+	}
+}
+
+func TestPanicRecovery(t *testing.T) {
+	handler := requestID(recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		var stations *Stations
+		w.Write([]byte(stations.ExecutionTime))
+	}), "Nil"))
+
+	req := httptest.NewRequest("GET", "/nil", nil)
+	req.Header.Set(requestIDHeader, "panic-test")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, req)
+
+	var problem Problem
+	json.Unmarshal(recorder.Body.Bytes(), &problem)
+	if recorder.Code != http.StatusInternalServerError || problem.RequestID != "panic-test" ||
+		recorder.Header().Get("Content-Type") != problemContentType || recorder.Header().Get("ETag") != "" {
+		t.Errorf("Expected a 500 problem for request panic-test Got %d %+v %v", recorder.Code, problem, recorder.Header())
+	}
+
+	// A response that has started is aborted rather than corrupted
+	handler = recoverPanic(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("late")
+	}), "Late")
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("Expected http.ErrAbortHandler Got %v", recovered)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/late", nil))
+}
+
+func TestPagination(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v1/stations?page=1&perPage=2", nil)
+	response := executeFixtureRequest(req)
+	resp := checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), true)
+	if len(resp) != 2 || response.Header().Get("X-Total-Count") != "5" {
+		t.Errorf("Expected 2 of 5 stations Got %d of %s", len(resp), response.Header().Get("X-Total-Count"))
+	}
+	link := response.Header().Get("Link")
+	for _, want := range []string{`</v1/stations?page=1&perPage=2>; rel="first"`,
+		`</v1/stations?page=2&perPage=2>; rel="next"`, `</v1/stations?page=3&perPage=2>; rel="last"`} {
+		if !strings.Contains(link, want) {
+			t.Errorf("Expected Link %s Got %s", want, link)
+		}
 	}
-	if station.Message != "No docks available" {
-		t.Errorf("Received more than zero for invalid dockable return")
+
+	// Past the last page is empty rather than the last page again
+	req, _ = http.NewRequest("GET", "/v1/stations?page=4&perPage=2", nil)
+	response = executeFixtureRequest(req)
+	if resp = checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), true); len(resp) != 0 {
+		t.Errorf("Expected no stations past the last page Got %d", len(resp))
+	}
+
+	// perPage is capped
+	req, _ = http.NewRequest("GET", "/v2/stations?perPage=100000", nil)
+	response = executeFixtureRequest(req)
+	var page StationPage
+	json.Unmarshal(response.Body.Bytes(), &page)
+	if page.PerPage != currentConfig().Server.MaxPerPage || page.Total != 5 || page.TotalPages != 1 {
+		t.Errorf("Expected perPage to be capped Got %+v", page.Pagination)
+	}
+
+	// Without paging parameters a listing longer than the maximum is paged from the first
+	previous := currentConfig()
+	defer liveConfig.Store(previous)
+	cfg := *previous
+	cfg.Server.MaxPerPage = 3
+	liveConfig.Store(&cfg)
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		response := httptest.NewRecorder()
+		App.Router.router.ServeHTTP(response, req)
+		if !strings.Contains(response.Header().Get("Link"), `rel="next"`) || response.Header().Get("X-Total-Count") != "5" {
+			t.Errorf("Expected %s to be paged Got %v", path, response.Header())
+		}
+		return response
+	}
+	response = get("/v1/stations")
+	if resp = checkResponseCodeAndUnmarshalJSON(t, http.StatusOK, response.Code, response.Body.String(), true); len(resp) != 3 {
+		t.Errorf("Expected the first 3 v1 stations Got %d", len(resp))
+	}
+	page = StationPage{}
+	json.Unmarshal(get("/v2/stations").Body.Bytes(), &page)
+	if len(page.Stations) != 3 || page.PerPage != 3 || page.TotalPages != 2 {
+		t.Errorf("Expected the first page of 3 Got %+v", page.Pagination)
+	}
+
+	req, _ = http.NewRequest("GET", "/v2/stations?cursor=not-a-cursor", nil)
+	if response = executeFixtureRequest(req); response.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid cursor Got %d", response.Code)
+	}
+}
+
+func TestCursorStableAcrossRefresh(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v2/stations?perPage=2", nil)
+	response := executeFixtureRequest(req)
+	var page StationPage
+	json.Unmarshal(response.Body.Bytes(), &page)
+	if len(page.Stations) != 2 || page.Stations[1].ID != 79 || page.NextCursor == "" {
+		t.Fatalf("Unexpected first page %+v", page)
+	}
+
+	// Refresh the snapshot without the first station; an offset would now skip 82
+	var snapshot Stations
+	fixture, _ := ioutil.ReadFile("testdata/stations.json")
+	json.Unmarshal(fixture, &snapshot)
+	snapshot.StationBeanList = snapshot.StationBeanList[1:]
+	refreshed, _ := json.Marshal(snapshot)
+	App.Cache.Set(feedCacheKey, refreshed)
+
+	req, _ = http.NewRequest("GET", "/v2/stations?perPage=2&cursor="+page.NextCursor, nil)
+	response = httptest.NewRecorder()
+	App.Router.router.ServeHTTP(response, req)
+	json.Unmarshal(response.Body.Bytes(), &page)
+	if len(page.Stations) != 2 || page.Stations[0].ID != 82 || page.Stations[1].ID != 83 {
+		t.Errorf("Expected the cursor to resume after station 79 Got %+v", page.Stations)
+	}
+
+	// The cursor only resumes the listing it was issued for
+	for uri, want := range map[string]int{
+		"/v2/stations?perPage=2&fields=id,name&cursor=":       http.StatusOK,
+		"/v2/stations?perPage=2&sort=-availableBikes&cursor=": http.StatusBadRequest,
+		"/v2/stations?perPage=2&status=in-service&cursor=":    http.StatusBadRequest,
+		"/v2/stations/not-in-service?perPage=2&cursor=":       http.StatusBadRequest,
+	} {
+		req, _ = http.NewRequest("GET", uri+page.NextCursor, nil)
+		response = httptest.NewRecorder()
+		App.Router.router.ServeHTTP(response, req)
+		if response.Code != want {
+			t.Errorf("%s: expected %d Got %d %s", uri, want, response.Code, response.Body.String())
+		}
+	}
+}
+
+func TestStationQuery(t *testing.T) {
+	ids := func(uri string) []int {
+		req, _ := http.NewRequest("GET", uri, nil)
+		response := executeFixtureRequest(req)
+		var page StationPage
+		if err := json.Unmarshal(response.Body.Bytes(), &page); err != nil || response.Code != http.StatusOK {
+			t.Errorf("%s: expected 200 Got %d %s", uri, response.Code, response.Body.String())
+		}
+		found := make([]int, 0)
+		for _, station := range page.Stations {
+			found = append(found, station.ID)
+		}
+		return found
+	}
+
+	for uri, want := range map[string]string{
+		"/v2/stations?minBikes=8":                                                    "[72 79 116]",
+		"/v2/stations?city=brooklyn":                                                 "[83]",
+		"/v2/stations?status=in-service&minDocks=25":                                 "[72 116]",
+		"/v2/stations?sort=-availableBikes":                                          "[79 116 72 82 83]",
+		"/v2/stations?sort=name&perPage=2":                                           "[83 79]",
+		"/v2/stations/in-service?status=not-in-service":                              "[72 79 82 116]",
+		"/v2/stations/near?lat=40.7112&lon=-74.0002&radius=1500&sort=availableDocks": "[79 82]",
+	} {
+		if got := fmt.Sprint(ids(uri)); got != want {
+			t.Errorf("%s: expected %s Got %s", uri, want, got)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/v1/stations?sort=name&fields=stationName", nil)
+	response := executeFixtureRequest(req)
+	var projected []map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &projected)
+	if len(projected) != 5 || len(projected[0]) != 1 || projected[0]["stationName"] != "Atlantic Ave & Fort Greene Pl" {
+		t.Errorf("Expected only station names, sorted Got %v", projected)
+	}
+
+	for _, uri := range []string{"/v2/stations?sort=availableDoks", "/v2/stations?status=closed",
+		"/v2/stations?minBikes=some", "/v1/stations?fields=id"} {
+		req, _ := http.NewRequest("GET", uri, nil)
+		if response := executeFixtureRequest(req); response.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Got %d", uri, response.Code)
+		}
+	}
+
+	// A misspelt filter is rejected rather than ignored
+	req, _ = http.NewRequest("GET", "/v2/stations?availableBike=3", nil)
+	response = executeFixtureRequest(req)
+	var problem Problem
+	json.Unmarshal(response.Body.Bytes(), &problem)
+	if response.Code != http.StatusBadRequest || problem.Type != problemInvalidParameter ||
+		!strings.Contains(problem.Detail, "did you mean availableBikes?") {
+		t.Errorf("Expected 400 suggesting availableBikes Got %d %+v", response.Code, problem)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	if terms := fmt.Sprint(tokenize("Bway & W 41st St")); terms != "[broadway west 41 street]" {
+		t.Errorf("Unexpected terms %s", terms)
+	}
+
+	for uri, want := range map[string]int{
+		"/v2/stations/brodway":            79,
+		"/v2/stations/Frnklin":            79,
+		"/v2/stations/W%2052nd%20Street":  72,
+		"/v2/stations/fifty%20two":        0,
+		"/v2/stations/st%20james%20place": 82,
+	} {
+		req, _ := http.NewRequest("GET", uri, nil)
+		response := executeFixtureRequest(req)
+		var page StationPage
+		json.Unmarshal(response.Body.Bytes(), &page)
+		if want == 0 {
+			if len(page.Stations) != 0 {
+				t.Errorf("%s: expected no results Got %+v", uri, page.Stations)
+			}
+			continue
+		}
+		if len(page.Stations) == 0 || page.Stations[0].ID != want || page.Stations[0].Score <= 0 {
+			t.Errorf("%s: expected %d first with a score Got %+v", uri, want, page.Stations)
+		}
+	}
+
+	// Results are ranked best first
+	req, _ := http.NewRequest("GET", "/v1/stations/w%20st", nil)
+	response := executeFixtureRequest(req)
+	var stations []ShortStation
+	json.Unmarshal(response.Body.Bytes(), &stations)
+	if len(stations) < 2 || stations[0].Score < stations[len(stations)-1].Score {
+		t.Errorf("Expected results ranked by score Got %+v", stations)
+	}
+
+	req, _ = http.NewRequest("GET", "/v2/stations/suggest?q=atl", nil)
+	response = executeFixtureRequest(req)
+	var suggestions []Suggestion
+	json.Unmarshal(response.Body.Bytes(), &suggestions)
+	if len(suggestions) != 1 || suggestions[0].ID != 83 {
+		t.Errorf("Expected Atlantic Ave to be suggested Got %+v", suggestions)
+	}
+
+	// v1 and the unversioned aliases suggest too, rather than searching for "suggest"
+	for _, uri := range []string{"/v1/stations/suggest?q=atl", "/stations/suggest?q=atl"} {
+		req, _ = http.NewRequest("GET", uri, nil)
+		response = executeFixtureRequest(req)
+		suggestions = nil
+		json.Unmarshal(response.Body.Bytes(), &suggestions)
+		if response.Code != http.StatusOK || len(suggestions) != 1 || suggestions[0].ID != 83 {
+			t.Errorf("%s: expected Atlantic Ave to be suggested Got %d %s", uri, response.Code, response.Body.String())
+		}
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/v2/stations?fields=id,name,address", nil)
+	req.Header.Set("Accept", "text/csv")
+	response := executeFixtureRequest(req)
+	lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+	if !strings.HasPrefix(response.Header().Get("Content-Type"), "text/csv") || len(lines) != 6 ||
+		lines[0] != "id,name,address.street1,address.street2,address.city,address.postalCode,address.landmark" ||
+		!strings.HasPrefix(lines[1], "72,W 52 St & 11 Ave,") {
+		t.Errorf("Unexpected CSV %s %q", response.Header().Get("Content-Type"), lines)
+	}
+
+	// The cache must not answer a JSON request with the CSV it just stored
+	req, _ = http.NewRequest("GET", "/v2/stations?fields=id,name,address", nil)
+	recorder := httptest.NewRecorder()
+	App.Router.router.ServeHTTP(recorder, req)
+	if recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON after CSV Got %s", recorder.Header().Get("Content-Type"))
+	}
+
+	req, _ = http.NewRequest("GET", "/v1/stations/in-service?format=geojson", nil)
+	response = executeFixtureRequest(req)
+	var collection struct {
+		Type     string
+		Features []struct {
+			ID       int
+			Geometry struct{ Coordinates []float64 }
+		}
+	}
+	json.Unmarshal(response.Body.Bytes(), &collection)
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 4 ||
+		collection.Features[0].Geometry.Coordinates[0] != -73.99392888 {
+		t.Errorf("Unexpected GeoJSON %s", response.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/v1/stations/not-in-service", nil)
+	req.Header.Set("Accept", "text/html, application/xml;q=0.9, */*;q=0.1")
+	response = executeFixtureRequest(req)
+	if !strings.Contains(response.Body.String(), "<station>\n    <stationName>Atlantic Ave &amp; Fort Greene Pl</stationName>") {
+		t.Errorf("Unexpected XML %s", response.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/v1/stations", nil)
+	req.Header.Set("Accept", "image/png")
+	if response = executeFixtureRequest(req); response.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected 406 Got %d", response.Code)
+	}
+}
+
+func TestBinaryEncodingsRoundTrip(t *testing.T) {
+	// fetch requests uri as JSON and in format, decoding the JSON into expected
+	fetch := func(uri, format string, expected interface{}) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", uri, nil)
+		response := executeFixtureRequest(req)
+		if err := json.Unmarshal(response.Body.Bytes(), expected); err != nil {
+			t.Fatalf("%s: %v", uri, err)
+		}
+		req, _ = http.NewRequest("GET", uri, nil)
+		req.Header.Set("Accept", format)
+		response = executeFixtureRequest(req)
+		if response.Code != http.StatusOK || response.Header().Get("Content-Type") != format {
+			t.Fatalf("%s as %s: %d %s", uri, format, response.Code, response.Header().Get("Content-Type"))
+		}
+		return response
+	}
+
+	var short []ShortStation
+	list := &pb.ShortStationList{}
+	proto.Unmarshal(fetch("/v1/stations", "application/x-protobuf", &short).Body.Bytes(), list)
+	if len(short) != 5 || !reflect.DeepEqual(list.Model(), short) {
+		t.Errorf("v1 protobuf Expected %v Got %v", short, list.Model())
+	}
+
+	var page StationPage
+	message := &pb.StationPage{}
+	proto.Unmarshal(fetch("/v2/stations?perPage=2", "application/x-protobuf", &page).Body.Bytes(), message)
+	if page.Total != 5 || !reflect.DeepEqual(message.Model(), page) {
+		t.Errorf("v2 protobuf Expected %v Got %v", page, message.Model())
+	}
+
+	var dockable BikesToReturn
+	bikes := &pb.BikesToReturn{}
+	proto.Unmarshal(fetch("/v1/dockable/72/2", "application/x-protobuf", &dockable).Body.Bytes(), bikes)
+	if !dockable.Dockable || !reflect.DeepEqual(bikes.Model(), dockable) {
+		t.Errorf("dockable protobuf Expected %v Got %v", dockable, bikes.Model())
+	}
+
+	// MessagePack uses the JSON keys, so it decodes into the same types
+	for uri, expected := range map[string]interface{}{
+		"/v1/stations/in-service":     &[]ShortStation{},
+		"/v2/stations/not-in-service": &StationPage{},
+		"/v1/dockable/79/1000":        &BikesToReturn{},
+	} {
+		body := fetch(uri, "application/msgpack", expected).Body
+		decoded := reflect.New(reflect.TypeOf(expected).Elem()).Interface()
+		decoder := msgpack.NewDecoder(body)
+		decoder.SetCustomStructTag("json")
+		if err := decoder.Decode(decoded); err != nil || !reflect.DeepEqual(decoded, expected) {
+			t.Errorf("%s msgpack Expected %v Got %v (%v)", uri, expected, decoded, err)
+		}
+	}
+
+	// Fields are projected in protobuf too, and formats dockable can't be written in are refused
+	req, _ := http.NewRequest("GET", "/v2/stations?format=protobuf&fields=id,name", nil)
+	message.Reset()
+	proto.Unmarshal(executeFixtureRequest(req).Body.Bytes(), message)
+	if station := message.GetStations()[0]; station.GetId() != 72 || station.GetName() == "" || station.GetAddress() != nil {
+		t.Errorf("Unexpected projected station %v", station)
+	}
+	req, _ = http.NewRequest("GET", "/v1/dockable/72/2?format=csv", nil)
+	if response := executeFixtureRequest(req); response.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Got %d", response.Code)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	setupTestApp()
+	fixture, _ := ioutil.ReadFile("testdata/stations.json")
+	App.Cache.Set(feedCacheKey, fixture)
+	feed.succeeded()
+
+	// An earlier shutdown test has stopped background work
+	background, stopBackground = context.WithCancel(context.Background())
+	defer stopBackground()
+
+	cfg := defaultConfig()
+	cfg.GRPC.WatchInterval = 50 * time.Millisecond
+	previous := currentConfig()
+	liveConfig.Store(cfg)
+	defer liveConfig.Store(previous)
+
+	listener := bufconn.Listen(1 << 20)
+	server, healthServer := newGRPCServer(cfg.GRPC)
+	go server.Serve(listener)
+	go reportGRPCHealth(background, healthServer)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stations := pb.NewStationsClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	list, _ := stations.ListStations(ctx, &pb.ListStationsRequest{
+		Filters: []*pb.Filter{{Name: "status", Values: []string{"in-service"}}},
+		Sort:    []string{"-availableDocks"},
+	})
+	var ids []int32
+	for {
+		station, err := list.Recv()
+		if err != nil {
+			break
+		}
+		ids = append(ids, station.GetId())
+	}
+	if fmt.Sprint(ids) != "[116 72 82 79]" {
+		t.Errorf("ListStations Expected [116 72 82 79] Got %v", ids)
+	}
+
+	station, err := stations.GetStation(ctx, &pb.GetStationRequest{Id: 72})
+	if err != nil || station.GetName() != "W 52 St & 11 Ave" || station.GetLocation().GetLatitude() == 0 {
+		t.Errorf("GetStation Got %v %v", station, err)
+	}
+	if _, err = stations.GetStation(ctx, &pb.GetStationRequest{Id: 9999}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetStation Expected NotFound Got %v", err)
+	}
+
+	found, err := stations.SearchStations(ctx, &pb.SearchStationsRequest{Query: "fort greene"})
+	if err != nil || len(found.GetStations()) != 1 || found.GetStations()[0].GetScore() == 0 {
+		t.Errorf("SearchStations Got %v %v", found, err)
+	}
+	if _, err = stations.SearchStations(ctx, &pb.SearchStationsRequest{Query: "ave", Filters: []*pb.Filter{{Name: "cty", Values: []string{"x"}}}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("SearchStations Expected InvalidArgument Got %v", err)
+	}
+
+	dockable, err := stations.CheckDockable(ctx, &pb.CheckDockableRequest{StationId: 72, BikesToReturn: 2})
+	if err != nil || !dockable.GetDockable() {
+		t.Errorf("CheckDockable Got %v %v", dockable, err)
+	}
+
+	// The first snapshot is streamed, then only what changes
+	watch, _ := stations.WatchStations(ctx, &pb.WatchStationsRequest{Filters: []*pb.Filter{{Name: "minDocks", Values: []string{"1"}}}})
+	for i := 0; i < 4; i++ {
+		if _, err := watch.Recv(); err != nil {
+			t.Fatalf("WatchStations %v", err)
+		}
+	}
+	var feedJSON Stations
+	json.Unmarshal(fixture, &feedJSON)
+	feedJSON.StationBeanList[0].AvailableBikes++
+	feedJSON.StationBeanList[2].AvailableDocks = 0
+	changed, _ := json.Marshal(feedJSON)
+	App.Cache.Set(feedCacheKey, changed)
+	first, _ := watch.Recv()
+	second, _ := watch.Recv()
+	if first.GetStation().GetId() != 72 || first.GetRemoved() || second.GetStation().GetId() != 82 || !second.GetRemoved() {
+		t.Errorf("WatchStations Got %v then %v", first, second)
+	}
+
+	check, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: "nbc.v1.Stations"})
+	if err != nil || check.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Health Got %v %v", check, err)
+	}
+}
+
+func TestGraphQL(t *testing.T) {
+	graphQL := func(query string) map[string]interface{} {
+		body, _ := json.Marshal(map[string]interface{}{"query": query})
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewReader(body))
+		var result map[string]interface{}
+		json.Unmarshal(executeFixtureRequest(req).Body.Bytes(), &result)
+		return result
+	}
+
+	result := graphQL(`{
+		near(lat: 40.76727216, lon: -73.99392888, minBikes: 5) { id name distance status { inService } }
+		dockable(stationId: 72, bikesToReturn: 2) { dockable }
+		station(id: 9999) { id }
+	}`)
+	data, _ := json.Marshal(result)
+	expected := `{"data":{"dockable":{"dockable":true},"near":[{"distance":0,"id":72,"name":"W 52 St \u0026 11 Ave","status":{"inService":true}}],"station":null}}`
+	if string(data) != expected {
+		t.Errorf("Expected %s Got %s", expected, data)
+	}
+
+	result = graphQL(`{ stations(filters: [{name: "cty", values: ["x"]}]) { id } }`)
+	if result["errors"] == nil {
+		t.Errorf("Expected an unknown filter error Got %v", result)
+	}
+
+	cfg := defaultConfig()
+	cfg.GraphQL.MaxDepth = 2
+	cfg.GraphQL.MaxComplexity = 50
+	previous := currentConfig()
+	liveConfig.Store(cfg)
+	defer liveConfig.Store(previous)
+
+	for query, message := range map[string]string{
+		`{ station(id: 72) { address { city } } }`: "depth 3",
+		`{ stations { id name } }`:                 "complexity 201",
+	} {
+		result = graphQL(query)
+		if !strings.Contains(fmt.Sprint(result["errors"]), message) || result["data"] != nil {
+			t.Errorf("Expected %s to be refused for %s Got %v", query, message, result)
+		}
+	}
+	if result = graphQL(`{ stations(limit: 2) { id name } }`); result["errors"] != nil {
+		t.Errorf("Expected a limit to lower the complexity Got %v", result)
+	}
+
+	cfg = defaultConfig()
+	cfg.GraphQL.WatchInterval = 50 * time.Millisecond
+	liveConfig.Store(cfg)
+
+	// An earlier shutdown test has stopped background work
+	background, stopBackground = context.WithCancel(context.Background())
+	defer stopBackground()
+	server := httptest.NewServer(App.Router.router)
+	defer server.Close()
+
+	body, _ := json.Marshal(map[string]string{"query": `subscription { stationUpdates(minDocks: 1) { station { id availableBikes } removed } }`})
+	req, _ := http.NewRequest("POST", server.URL+"/graphql", bytes.NewReader(body))
+	req.Header.Set("Accept", "text/event-stream")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	response, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	if response.Header.Get("Content-Type") != "text/event-stream" {
+		data, _ := ioutil.ReadAll(response.Body)
+		t.Fatalf("Expected an event stream Got %s %s", response.Header.Get("Content-Type"), data)
+	}
+
+	events := bufio.NewScanner(response.Body)
+	next := func() string {
+		for events.Scan() {
+			if line := events.Text(); strings.HasPrefix(line, "data: ") {
+				return strings.TrimPrefix(line, "data: ")
+			}
+		}
+		return ""
+	}
+	for i := 0; i < 4; i++ {
+		next()
+	}
+	fixture, _ := ioutil.ReadFile("testdata/stations.json")
+	var feedJSON Stations
+	json.Unmarshal(fixture, &feedJSON)
+	feedJSON.StationBeanList[0].AvailableBikes++
+	changed, _ := json.Marshal(feedJSON)
+	App.Cache.Set(feedCacheKey, changed)
+	expected = `{"data":{"stationUpdates":{"removed":false,"station":{"availableBikes":9,"id":72}}}}`
+	if update := next(); update != expected {
+		t.Errorf("Expected %s Got %s", expected, update)
+	}
+}
+
+func TestCompressionAndConditionalRequests(t *testing.T) {
+	setupTestApp()
+	fixture, _ := ioutil.ReadFile("testdata/stations.json")
+	App.Cache.Set(feedCacheKey, fixture)
+	feed.succeeded()
+
+	get := func(uri string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", uri, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		App.Router.router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	plain := get("/v2/stations", nil)
+	etag := plain.Header().Get("ETag")
+	if plain.Header().Get("Content-Encoding") != "" || !strings.HasPrefix(etag, `"`) || plain.Header().Get("Last-Modified") == "" ||
+		!strings.HasPrefix(plain.Header().Get("Cache-Control"), "public, max-age=") || plain.Header().Get("Cache-Control") == "public, max-age=0" {
+		t.Errorf("Unexpected headers %v", plain.Header())
+	}
+
+	for encoding, decode := range map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	} {
+		response := get("/v2/stations", map[string]string{"Accept-Encoding": encoding})
+		reader, err := decode(response.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(reader)
+		if response.Header().Get("Content-Encoding") != encoding || !bytes.Equal(body, plain.Body.Bytes()) ||
+			response.Header().Get("ETag") != "W/"+etag || !strings.Contains(strings.Join(response.Header().Values("Vary"), ","), "Accept-Encoding") {
+			t.Errorf("Unexpected %s response %v %d bytes", encoding, response.Header(), len(body))
+		}
+	}
+
+	// Responses shorter than the minimum size aren't worth encoding
+	if small := get("/v2/dockable/72/2", map[string]string{"Accept-Encoding": "gzip"}); small.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected a short response to be sent as is Got %s", small.Header().Get("Content-Encoding"))
+	}
+
+	for _, match := range []string{etag, "W/" + etag, `"other", ` + etag} {
+		response := get("/v2/stations", map[string]string{"If-None-Match": match, "Accept-Encoding": "gzip"})
+		if response.Code != http.StatusNotModified || response.Body.Len() != 0 || response.Header().Get("ETag") != etag {
+			t.Errorf("If-None-Match %s Expected 304 Got %d %v", match, response.Code, response.Header())
+		}
+	}
+	if response := get("/v2/stations", map[string]string{"If-Modified-Since": plain.Header().Get("Last-Modified")}); response.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since Expected 304 Got %d", response.Code)
+	}
+	if response := get("/v2/stations?format=csv", map[string]string{"If-None-Match": etag}); response.Code != http.StatusOK {
+		t.Errorf("Expected the CSV representation to have its own ETag Got %d", response.Code)
+	}
+
+	// A new snapshot changes the ETag
+	var feedJSON Stations
+	json.Unmarshal(fixture, &feedJSON)
+	feedJSON.StationBeanList[0].AvailableBikes++
+	changed, _ := json.Marshal(feedJSON)
+	App.Cache.Set(feedCacheKey, changed)
+	// The http-cache replays the old response, with its ETag, until it expires
+	if response := get("/v2/stations", map[string]string{"If-None-Match": etag}); response.Code != http.StatusNotModified {
+		t.Errorf("Expected the cached response until it expires Got %d", response.Code)
+	}
+	App.Router.setCacheTTL(currentConfig().Server.MemCacheTime)
+	if response := get("/v2/stations", map[string]string{"If-None-Match": etag}); response.Code != http.StatusOK || response.Header().Get("ETag") == etag {
+		t.Errorf("Expected a fresh response after the snapshot changed Got %d %s", response.Code, response.Header().Get("ETag"))
+	}
+}
+
+func TestCORS(t *testing.T) {
+	setupTestApp()
+	fixture, _ := ioutil.ReadFile("testdata/stations.json")
+	App.Cache.Set(feedCacheKey, fixture)
+
+	cfg := defaultConfig()
+	cfg.CORS.AllowedOrigins = "https://app.example.com, https://*.example.org"
+	cfg.CORS.AllowCredentials = true
+	previous := currentConfig()
+	liveConfig.Store(cfg)
+	defer liveConfig.Store(previous)
+
+	send := func(method string, uri string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, uri, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		App.Router.router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	response := send("GET", "/v2/stations", map[string]string{"Origin": "https://app.example.com"})
+	if response.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		response.Header().Get("Access-Control-Allow-Credentials") != "true" ||
+		!strings.Contains(response.Header().Get("Access-Control-Expose-Headers"), "ETag") ||
+		!strings.Contains(strings.Join(response.Header().Values("Vary"), ","), "Origin") {
+		t.Errorf("Unexpected CORS headers %v", response.Header())
+	}
+	if response = send("GET", "/v2/stations", map[string]string{"Origin": "https://evil.example.com"}); response.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected no CORS headers for an unknown origin Got %v", response.Header())
+	}
+
+	response = send("OPTIONS", "/v2/stations/near", map[string]string{"Origin": "https://maps.example.org",
+		"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "if-none-match, x-request-id"})
+	if response.Code != http.StatusNoContent || response.Header().Get("Access-Control-Allow-Origin") != "https://maps.example.org" ||
+		response.Header().Get("Access-Control-Allow-Methods") != "GET" || response.Header().Get("Access-Control-Max-Age") != "600" ||
+		response.Header().Get("Access-Control-Allow-Headers") != "if-none-match, x-request-id" {
+		t.Errorf("Unexpected preflight %d %v", response.Code, response.Header())
+	}
+	response = send("OPTIONS", "/graphql", map[string]string{"Origin": "https://app.example.com",
+		"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "content-type"})
+	if response.Code != http.StatusNoContent || response.Header().Get("Access-Control-Allow-Methods") != "POST" {
+		t.Errorf("Unexpected /graphql preflight %d %v", response.Code, response.Header())
+	}
+
+	for name, headers := range map[string]map[string]string{
+		"origin": {"Origin": "https://evil.com", "Access-Control-Request-Method": "GET"},
+		"method": {"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE"},
+		"header": {"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Secret"},
+	} {
+		response = send("OPTIONS", "/v1/stations", headers)
+		if response.Code != http.StatusForbidden || !strings.Contains(response.Body.String(), problemCORSRejected) {
+			t.Errorf("Expected the preflight to be rejected for its %s Got %d %s", name, response.Code, response.Body.String())
+		}
+	}
+
+	if response = send("OPTIONS", "/v1/stations", nil); response.Code != http.StatusNoContent || response.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Errorf("Expected Allow: GET, OPTIONS Got %d %v", response.Code, response.Header())
+	}
+	if response = send("OPTIONS", "/nowhere", map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET"}); response.Code != http.StatusNotFound {
+		t.Errorf("Expected a preflight for an unknown path to be 404 Got %d", response.Code)
+	}
+}
+
+// testCertificate A certificate for commonName signed by parent (self-signed without
+// one), valid for 127.0.0.1. Its PEM files are written to dir as name.pem and name.key
+func testCertificate(t *testing.T, dir string, name string, commonName string, parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	issuer, signer := template, interface{}(key)
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		issuer, signer = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	ioutil.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), keyPEM, 0600)
+
+	certificate, _ := tls.X509KeyPair(certPEM, keyPEM)
+	certificate.Leaf, _ = x509.ParseCertificate(der)
+	return certificate
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := testCertificate(t, dir, "ca", "Test CA", nil)
+	testCertificate(t, dir, "server", "server", &ca)
+	client := testCertificate(t, dir, "client", "admin", &ca)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Leaf)
+
+	setupTestApp()
+	cfg := defaultConfig()
+	cfg.TLS = TLSConfig{CertFile: filepath.Join(dir, "server.pem"), KeyFile: filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"), MinVersion: "1.2"}
+	previous := currentConfig()
+	liveConfig.Store(cfg)
+	defer liveConfig.Store(previous)
+
+	certs, err := loadCertificates(cfg.TLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	srv := &http.Server{Handler: App.Router.router, TLSConfig: certs.serverConfig()}
+	go srv.ServeTLS(listener, "", "")
+	defer srv.Close()
+	base := "https://" + listener.Addr().String()
+
+	newClient := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certificates},
+			ForceAttemptHTTP2: true,
+			DisableKeepAlives: true,
+		}}
+	}
+
+	response, err := newClient().Get(base + "/healthz")
+	if err != nil || response.StatusCode != http.StatusOK || response.ProtoMajor != 2 {
+		t.Fatalf("Expected HTTP/2 over TLS Got %v %v", response, err)
+	}
+	response.Body.Close()
+
+	// adminOnly routes need a client certificate from the CA
+	if response, err = newClient().Get(base + "/metrics"); err != nil || response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 without a client certificate Got %v %v", response, err)
+	} else {
+		response.Body.Close()
+	}
+	if response, err = newClient(client).Get(base + "/metrics"); err != nil || response.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 with a client certificate Got %v %v", response, err)
+	} else {
+		response.Body.Close()
+	}
+
+	// A replaced certificate is picked up without a restart
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchCertificates(ctx, certs)
+	time.Sleep(100 * time.Millisecond)
+	testCertificate(t, dir, "server", "reloaded", &ca)
+	served := ""
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && served != "reloaded"; time.Sleep(100 * time.Millisecond) {
+		if response, err := newClient().Get(base + "/healthz"); err == nil {
+			served = response.TLS.PeerCertificates[0].Subject.CommonName
+			response.Body.Close()
+		}
+	}
+	if served != "reloaded" {
+		t.Errorf("Expected the reloaded certificate Got %s", served)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com:8080/graphql?x=1", nil)
+	recorder := httptest.NewRecorder()
+	httpsRedirect("8443").ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusPermanentRedirect || recorder.Header().Get("Location") != "https://example.com:8443/graphql?x=1" {
+		t.Errorf("Unexpected redirect %d %s", recorder.Code, recorder.Header().Get("Location"))
+	}
+}
+
+func TestListeners(t *testing.T) {
+	if _, err := (ServerConfig{Network: "tcp", Address: "127.0.0.1", Port: "4000", Listeners: "admin=udp:127.0.0.1:4002"}).listeners(); err == nil {
+		t.Error("Expected an error for a udp listener")
+	}
+
+	setupTestApp()
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	cfg := defaultConfig()
+	cfg.Server.Listeners = "admin=unix:" + socket
+	// Clients of a unix socket don't need a certificate for adminOnly routes
+	cfg.TLS.ClientCAFile = "ca.pem"
+	previous := currentConfig()
+	liveConfig.Store(cfg)
+	defer func() {
+		liveConfig.Store(previous)
+		App.Router.Load()
+	}()
+	if err := App.Router.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	specs, err := cfg.Server.listeners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs[0].Address = "127.0.0.1:0"
+	listeners, err := listen(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, spec := range specs {
+		srv := &http.Server{Handler: App.Router.handler(spec.Name)}
+		go srv.Serve(listeners[i])
+		defer srv.Close()
+	}
+
+	public := &http.Client{}
+	admin := &http.Client{Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+	}}}
+	base := "http://" + listeners[0].Addr().String()
+
+	for _, c := range []struct {
+		client *http.Client
+		url    string
+		status int
+	}{
+		{public, base + "/teapot", http.StatusTeapot},
+		{public, base + "/healthz", http.StatusOK},
+		{public, base + "/metrics", http.StatusNotFound},
+		{admin, "http://admin/metrics", http.StatusOK},
+		{admin, "http://admin/healthz", http.StatusOK},
+		{admin, "http://admin/teapot", http.StatusNotFound},
+	} {
+		response, err := c.client.Get(c.url)
+		if err != nil {
+			t.Errorf("%s: %s", c.url, err)
+			continue
+		}
+		response.Body.Close()
+		if response.StatusCode != c.status {
+			t.Errorf("%s: Expected %d Got %d", c.url, c.status, response.StatusCode)
+		}
+	}
+}
+
+func TestListenInheritsListeners(t *testing.T) {
+	specs := []ListenerConfig{{Name: defaultListener, Network: "tcp", Address: "127.0.0.1:0"},
+		{Name: grpcListener, Network: "tcp", Address: "127.0.0.1:0"}}
+	parent, err := listen(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeListeners(parent)
+
+	var fds []string
+	for _, listener := range parent {
+		file, err := listener.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		fds = append(fds, strconv.Itoa(int(file.Fd())))
+	}
+	t.Setenv(listenFDEnv, strings.Join(fds, ","))
+
+	if _, err := listen(specs[:1]); err == nil {
+		t.Error("Expected an error when fewer listeners are configured than inherited")
+	}
+	child, err := listen(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeListeners(child)
+	for i := range child {
+		if child[i].Addr().String() != parent[i].Addr().String() {
+			t.Errorf("Expected listener %d on %s Got %s", i, parent[i].Addr(), child[i].Addr())
+		}
 	}
 }
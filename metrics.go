@@ -0,0 +1,191 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const metricsNamespace = "nbc"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route name and status code.",
+	}, []string{"route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency, by route name and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "status"})
+
+	httpPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_panics_total",
+		Help:      "Panics recovered while serving HTTP requests, by route name.",
+	}, []string{"route"})
+
+	upstreamFetchDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_fetch_duration_seconds",
+		Help:      "Latency of CitiBike feed fetches.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	upstreamFetchErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_fetch_errors_total",
+		Help:      "Failed CitiBike feed fetches.",
+	})
+
+	upstreamFetchBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_fetch_bytes_total",
+		Help:      "Bytes read from the CitiBike feed.",
+	})
+
+	stationGauges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "stations",
+		Help:      "Stations in the current snapshot, by service state.",
+	}, []string{"state"})
+
+	bikesAvailable = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "bikes_available",
+		Help:      "Available bikes across all stations in the current snapshot.",
+	})
+
+	docksAvailable = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "docks_available",
+		Help:      "Available docks across all stations in the current snapshot.",
+	})
+
+	docksTotal = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "docks_total",
+		Help:      "Total docks across all stations in the current snapshot.",
+	})
+
+	snapshotAge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "snapshot_age_seconds",
+		Help:      "Seconds since the CitiBike feed was last fetched successfully, -1 if never.",
+	}, feedAgeSeconds)
+
+	// httpCacheHits and httpCacheMisses are counted by logRequest, accessed atomically
+	httpCacheHits   int64
+	httpCacheMisses int64
+
+	// metricsHandler Serves the default registry to every scrape
+	metricsHandler = promhttp.Handler()
+)
+
+func init() {
+	prometheus.MustRegister(httpRequests, httpRequestDuration, httpPanics, upstreamFetchDuration, upstreamFetchErrors,
+		upstreamFetchBytes, stationGauges, bikesAvailable, docksAvailable, docksTotal, snapshotAge,
+		cacheCollector{})
+}
+
+// GetMetrics Exposes all metrics in the Prometheus text format
+func GetMetrics(w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// observeRequest Record a completed request against its route, and the http-cache
+// result, "hit" or "miss", if the route has a cache
+func observeRequest(route string, status int, duration time.Duration, cache string) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, code).Inc()
+	httpRequestDuration.WithLabelValues(route, code).Observe(duration.Seconds())
+
+	switch cache {
+	case "hit":
+		atomic.AddInt64(&httpCacheHits, 1)
+	case "miss":
+		atomic.AddInt64(&httpCacheMisses, 1)
+	}
+}
+
+// observeStations Update the station gauges from a freshly loaded snapshot
+func observeStations(stations []Station) {
+	var inService, notInService, bikes, docks, total int
+	for _, station := range stations {
+		switch station.StatusKey {
+		case StatusOk:
+			inService++
+		case StatusNotOk:
+			notInService++
+		}
+		bikes += station.AvailableBikes
+		docks += station.AvailableDocks
+		total += station.TotalDocks
+	}
+
+	stationGauges.WithLabelValues("total").Set(float64(len(stations)))
+	stationGauges.WithLabelValues("in_service").Set(float64(inService))
+	stationGauges.WithLabelValues("not_in_service").Set(float64(notInService))
+	bikesAvailable.Set(float64(bikes))
+	docksAvailable.Set(float64(docks))
+	docksTotal.Set(float64(total))
+}
+
+// feedAgeSeconds Seconds since the last successful upstream fetch, -1 if never
+func feedAgeSeconds() float64 {
+	age := feed.age()
+	if age < 0 {
+		return -1
+	}
+	return age.Seconds()
+}
+
+// httpCacheStats Hits and misses counted by logRequest
+func httpCacheStats() (int64, int64) {
+	return atomic.LoadInt64(&httpCacheHits), atomic.LoadInt64(&httpCacheMisses)
+}
+
+// cacheCollector Reports hit and miss counts and hit ratios for BigCache and http-cache
+type cacheCollector struct{}
+
+var (
+	cacheHitsDesc = prometheus.NewDesc(metricsNamespace+"_cache_hits_total",
+		"Cache hits, by cache.", []string{"cache"}, nil)
+	cacheMissesDesc = prometheus.NewDesc(metricsNamespace+"_cache_misses_total",
+		"Cache misses, by cache.", []string{"cache"}, nil)
+	cacheHitRatioDesc = prometheus.NewDesc(metricsNamespace+"_cache_hit_ratio",
+		"Ratio of hits to lookups since start, by cache.", []string{"cache"}, nil)
+)
+
+// Describe Implements prometheus.Collector
+func (c cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheHitRatioDesc
+}
+
+// Collect Implements prometheus.Collector
+func (c cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	if App.Cache != nil {
+		stats := App.Cache.Stats()
+		c.collect(ch, "bigcache", stats.Hits, stats.Misses)
+	}
+	hits, misses := httpCacheStats()
+	c.collect(ch, "http", hits, misses)
+}
+
+func (c cacheCollector) collect(ch chan<- prometheus.Metric, name string, hits int64, misses int64) {
+	ratio := 0.0
+	if hits+misses > 0 {
+		ratio = float64(hits) / float64(hits+misses)
+	}
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(hits), name)
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(misses), name)
+	ch <- prometheus.MustNewConstMetric(cacheHitRatioDesc, prometheus.GaugeValue, ratio, name)
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"time"
 )
 
 func (R *Router) registerMiddleWare() {
@@ -9,36 +13,103 @@ func (R *Router) registerMiddleWare() {
 	R.middlewares["adminOnly"] = adminOnly
 }
 
-// adminOnly Checks if a user is an admin
+// adminOnly Checks if a user is an admin: with TLS_CLIENT_CA_FILE set, the client must
+// have presented a certificate that CA signed. Unix sockets are served in the clear and
+// guarded by their file permissions, so their clients are trusted
 func adminOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Logic here to determine if user is admin user
+		if currentConfig().TLS.ClientCAFile != "" && !localSocket(r) && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			HandleProblem(w, r, newProblem(http.StatusForbidden, problemClientCertificate, "A trusted client certificate is required"))
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-// logRequest Middleware which logs each request
+// localSocket Reports whether r arrived on a unix socket listener
+func localSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// logRequest Middleware which records metrics and writes a structured access log
+// entry once the request has completed, including cache hits served by http-cache
 func logRequest(next http.Handler, name string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		Logger.LogHTTPRequest(name, w, r)
-		next.ServeHTTP(w, r)
+		start := time.Now()
+		recorder := &responseRecorder{ResponseWriter: w}
+		status := &cacheStatus{}
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), cacheStatusKey, status)))
+
+		cache := status.result()
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		latency := time.Since(start)
+		observeRequest(name, recorder.status, latency, cache)
+
+		if !logEnabled(levelInfo) {
+			return
+		}
+		App.AccessLog.Write(accessLogEntry{
+			Time:      start.UTC().Format(time.RFC3339Nano),
+			RequestID: requestIDFromContext(r.Context()),
+			Method:    r.Method,
+			Route:     name,
+			URI:       r.RequestURI,
+			Status:    recorder.status,
+			Bytes:     recorder.bytes,
+			LatencyMS: float64(latency) / float64(time.Millisecond),
+			Cache:     cache,
+			ClientIP:  clientIP(r),
+		})
 	})
 }
 
-// basicHeaders Apply our general headers
-func basicHeaders(next http.Handler) http.Handler {
+// deprecated Marks responses from an unversioned alias as deprecated, pointing at the
+// same path under successorPrefix and announcing the sunset date (YYYY-MM-DD)
+func deprecated(next http.Handler, successorPrefix string, sunset string) http.Handler {
+	sunsetHeader := ""
+	if date, err := time.Parse("2006-01-02", sunset); err == nil {
+		sunsetHeader = date.UTC().Format(http.TimeFormat)
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		if origin := r.Header.Get("Origin"); origin != "" {
-			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			w.Header().Set("Access-Control-Allow-Headers",
-				"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		w.Header().Set("Deprecation", "true")
+		if sunsetHeader != "" {
+			w.Header().Set("Sunset", sunsetHeader)
 		}
-		// Stop here if its Preflighted OPTIONS request
-		if r.Method == "OPTIONS" {
-			return
-		}
-		next.ServeHTTP(w, r)
+		link := fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successorPrefix, r.URL.EscapedPath())
+		next.ServeHTTP(&deprecatedWriter{ResponseWriter: w, link: link}, r)
 	})
 }
+
+// deprecatedWriter Adds the successor-version link once the response headers are
+// written. http-cache sets the headers it replays, so a link added before the chain
+// runs would be replaced by the route's own, e.g. its page links
+type deprecatedWriter struct {
+	http.ResponseWriter
+	link        string
+	wroteHeader bool
+}
+
+func (w *deprecatedWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Add("Link", w.link)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *deprecatedWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap The underlying writer, so http.ResponseController can flush through us
+func (w *deprecatedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,109 @@
+// Package model The station types served by the NBC API, shared by the server
+// and the client package
+package model
+
+// Station A station as published in the CitiBike feed
+type Station struct {
+	Id                    int     `json:"id"`
+	StationName           string  `json:"stationName"`
+	AvailableDocks        int     `json:"availableDocks"`
+	TotalDocks            int     `json:"totalDocks"`
+	Latitude              float64 `json:"latitude"`
+	Longitude             float64 `json:"longitude"`
+	StatusValue           string  `json:"statusValue"`
+	StatusKey             int     `json:"statusKey"`
+	AvailableBikes        int     `json:"availableBikes"`
+	Address1              string  `json:"stAddress1"`
+	Address2              string  `json:"stAddress2"`
+	City                  string  `json:"city"`
+	PostalCode            string  `json:"postalCode"`
+	Location              string  `json:"location"`
+	Altitude              string  `json:"altitude"`
+	TestStation           bool    `json:"testStation"`
+	LastCommunicationTime string  `json:"lastCommunicationTime"`
+	Landmark              string  `json:"landMark"`
+}
+
+// ShortStation The v1 station representation
+type ShortStation struct {
+	StationName    string  `json:"stationName"`
+	Address        string  `json:"address"`
+	AvailableDocks int     `json:"availableDocks"`
+	TotalDocks     int     `json:"totalDocks"`
+	Score          float64 `json:"score,omitempty"`
+}
+
+// BikesToReturn Whether bikes can be docked at a station
+type BikesToReturn struct {
+	Dockable bool   `json:"dockable"`
+	Message  string `json:"message"`
+}
+
+// StationDetail The v2 station representation. Distance is set, in meters, by
+// queries near a point and Score, from 0 to 1, by searches
+type StationDetail struct {
+	ID                    int             `json:"id"`
+	Name                  string          `json:"name"`
+	Address               StationAddress  `json:"address"`
+	Location              StationLocation `json:"location"`
+	Status                StationStatus   `json:"status"`
+	AvailableBikes        int             `json:"availableBikes"`
+	AvailableDocks        int             `json:"availableDocks"`
+	TotalDocks            int             `json:"totalDocks"`
+	TestStation           bool            `json:"testStation"`
+	LastCommunicationTime string          `json:"lastCommunicationTime"`
+	Distance              float64         `json:"distance,omitempty"`
+	Score                 float64         `json:"score,omitempty"`
+}
+
+// Suggestion A station completing an autocomplete query, scored from 0 to 1
+type Suggestion struct {
+	ID    int     `json:"id"`
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// StationAddress The postal address of a station
+type StationAddress struct {
+	Street1    string `json:"street1"`
+	Street2    string `json:"street2,omitempty"`
+	City       string `json:"city,omitempty"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Landmark   string `json:"landmark,omitempty"`
+}
+
+// StationLocation The coordinates of a station
+type StationLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  string  `json:"altitude,omitempty"`
+}
+
+// StationStatus The service status of a station
+type StationStatus struct {
+	Key       int    `json:"key"`
+	Value     string `json:"value"`
+	InService bool   `json:"inService"`
+}
+
+// Station status keys used by the feed
+const (
+	StatusOk    int = 1
+	StatusNotOk int = 3
+)
+
+// Pagination Where a page sits in a listing. NextCursor resumes the listing after
+// this page and stays valid when the snapshot is refreshed
+type Pagination struct {
+	Total      int    `json:"total"`
+	Page       int    `json:"page"`
+	PerPage    int    `json:"perPage"`
+	TotalPages int    `json:"totalPages"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// StationPage A page of a v2 station listing
+type StationPage struct {
+	Stations []StationDetail `json:"stations"`
+	Pagination
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pathPatterns Strips the regular expression from mux {name:pattern} variables
+var pathPatterns = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// GetOpenAPI Serves an OpenAPI 3 document generated from the registered routes
+func GetOpenAPI(w http.ResponseWriter, req *http.Request) {
+	HandleResponse(w, req, openAPISpec(App.Router.Routes), http.StatusOK)
+}
+
+// GetDocs Serves a Swagger UI page for /openapi.json
+func GetDocs(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, docsPage, App.Name)
+}
+
+// openAPISpec Build the OpenAPI document for routes. Response bodies are described
+// by reflecting over the types registered in handlerRegistry
+func openAPISpec(routes []Route) map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+
+	for _, route := range routes {
+		path := pathPatterns.ReplaceAllString(route.URI, "{$1}")
+		operations, ok := paths[path].(map[string]interface{})
+		if !ok {
+			operations = make(map[string]interface{})
+			paths[path] = operations
+		}
+
+		parameters := make([]interface{}, 0, len(route.Parameters))
+		for _, parameter := range route.Parameters {
+			parameters = append(parameters, map[string]interface{}{
+				"name":        parameter.Name,
+				"in":          parameter.In,
+				"required":    parameter.Required,
+				"description": parameter.Description,
+				"schema":      map[string]interface{}{"type": parameter.Type},
+			})
+		}
+
+		responses := make(map[string]interface{})
+		for status, body := range route.responses {
+			contentType := "application/json"
+			if _, ok := body.(Problem); ok {
+				contentType = problemContentType
+			}
+			content := map[string]interface{}{
+				contentType: map[string]interface{}{
+					"schema": schemaFor(reflect.TypeOf(body), schemas),
+				},
+			}
+			// Negotiated responses can also be written in the route's other formats
+			if len(route.encoders) > 0 && status == http.StatusOK {
+				for _, mediaType := range mediaTypes(route.encoders)[1:] {
+					content[mediaType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}
+				}
+			}
+			responses[strconv.Itoa(status)] = map[string]interface{}{
+				"description": http.StatusText(status),
+				"content":     content,
+			}
+		}
+
+		operation := map[string]interface{}{
+			"operationId": route.Name,
+			"summary":     route.Summary,
+			"parameters":  parameters,
+			"responses":   responses,
+		}
+		if route.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(route.request), schemas)},
+				},
+			}
+		}
+		if route.Version != "" {
+			operation["tags"] = []string{route.Version}
+		}
+		if route.Deprecated {
+			operation["deprecated"] = true
+		}
+		operations[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   App.Name,
+			"version": App.Version,
+		},
+		"servers":    []interface{}{map[string]interface{}{"url": "/"}},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas},
+	}
+}
+
+// schemaFor The JSON schema for t. Named structs are added to schemas and referenced
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaFor(t.Elem(), schemas)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := schemas[t.Name()]; ok {
+			return ref
+		}
+
+		properties := make(map[string]interface{})
+		schemas[t.Name()] = map[string]interface{}{"type": "object", "properties": properties}
+		var required []string
+		for _, field := range jsonFields(t) {
+			name, options := field.Name, ""
+			if tag := field.Tag.Get("json"); tag != "" {
+				parts := strings.SplitN(tag, ",", 2)
+				if parts[0] == "-" {
+					continue
+				}
+				if parts[0] != "" {
+					name = parts[0]
+				}
+				if len(parts) > 1 {
+					options = parts[1]
+				}
+			}
+			properties[name] = schemaFor(field.Type, schemas)
+			if !strings.Contains(options, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		if len(required) > 0 {
+			sort.Strings(required)
+			schemas[t.Name()].(map[string]interface{})["required"] = required
+		}
+		return ref
+	}
+
+	return map[string]interface{}{}
+}
+
+// jsonFields The exported fields of struct type t as encoding/json sees them, with
+// the fields of untagged embedded structs promoted
+func jsonFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			fields = append(fields, jsonFields(field.Type)...)
+			continue
+		}
+		if field.PkgPath == "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// docsPage Swagger UI, loaded from a CDN and pointed at /openapi.json
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>%s API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = function () {
+      window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});
+    };
+  </script>
+</body>
+</html>
+`
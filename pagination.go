@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/jsanc623/NBC/model"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Pagination Where a page sits in a listing; shared with API clients through the model package
+type Pagination = model.Pagination
+
+// defaultPerPage The page size when paging without ?perPage
+const defaultPerPage = 20
+
+// stationKey The sort key of a station in a listing, of float64, string and bool values
+type stationKey func(Station) []interface{}
+
+// stationOrder How a listing is sorted: by key, each element ascending unless it is
+// descending, and then by ID so that every listing has a total order. The zero
+// value orders by ID
+type stationOrder struct {
+	key        stationKey
+	descending []bool
+}
+
+// cursor The sort key and ID of the last station on a page. A cursor page starts
+// after that position rather than at an offset, so stations added or removed by a
+// snapshot refresh don't make clients skip or repeat stations. Spec is the listingSpec
+// of the request it was issued for, which it may only be used with
+type cursor struct {
+	Key  []interface{} `json:"k,omitempty"`
+	ID   int           `json:"i"`
+	Spec string        `json:"s,omitempty"`
+}
+
+// encodeCursor The opaque token for the position of station in the listing spec
+func encodeCursor(station Station, order stationOrder, spec string) string {
+	c := cursor{ID: station.Id, Key: order.keyOf(station), Spec: spec}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor The position held by token
+func decodeCursor(token string) (c cursor, err error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	return c, err
+}
+
+// keyOf The sort key of station, nil when ordering by ID
+func (O stationOrder) keyOf(station Station) []interface{} {
+	if O.key == nil {
+		return nil
+	}
+	return O.key(station)
+}
+
+// compare Orders a against the position (key, id): -1, 0 or 1
+func (O stationOrder) compare(a Station, position cursor) int {
+	if c := compareKeys(O.keyOf(a), position.Key, O.descending); c != 0 {
+		return c
+	}
+	switch {
+	case a.Id < position.ID:
+		return -1
+	case a.Id > position.ID:
+		return 1
+	}
+	return 0
+}
+
+// compareKeys Orders two sort keys element by element, reversing the elements
+// marked descending. Numbers must be float64, as they are once a cursor has been decoded
+func compareKeys(a, b []interface{}, descending []bool) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		var c int
+		switch x := a[i].(type) {
+		case float64:
+			y, _ := b[i].(float64)
+			c = compareOrdered(x, y)
+		case string:
+			y, _ := b[i].(string)
+			c = compareOrdered(x, y)
+		case bool:
+			y, _ := b[i].(bool)
+			c = compareOrdered(fmt.Sprint(x), fmt.Sprint(y))
+		}
+		if i < len(descending) && descending[i] {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareOrdered(len(a), len(b))
+}
+
+// compareOrdered -1, 0 or 1 as a is less than, equal to or greater than b
+func compareOrdered[T int | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sortStations A copy of stations ordered by order
+func sortStations(stations []Station, order stationOrder) []Station {
+	sorted := append([]Station{}, stations...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return order.compare(sorted[i], cursor{ID: sorted[j].Id, Key: order.keyOf(sorted[j])}) < 0
+	})
+	return sorted
+}
+
+// paginate Orders stations by order and selects the page asked for by the
+// page, perPage or cursor query parameters. Without any of them a listing of up to
+// SRV_MAX_PER_PAGE stations is one page, and a longer one is paged from the first.
+// X-Total-Count and Link headers are set on w
+func paginate(w http.ResponseWriter, r *http.Request, stations []Station, order stationOrder) ([]Station, Pagination, *Problem) {
+	sorted := sortStations(stations, order)
+	total := len(sorted)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	query := r.URL.Query()
+	_, paged := query["page"]
+	_, limited := query["perPage"]
+	token := query.Get("cursor")
+	maxPerPage := currentConfig().Server.MaxPerPage
+	if !paged && !limited && token == "" && total <= maxPerPage {
+		return sorted, Pagination{Total: total, Page: 1, PerPage: total, TotalPages: 1}, nil
+	}
+
+	// Allow count per page, up to the configured maximum
+	perPage := defaultPerPage
+	if perPageOverride, err := strconv.Atoi(query.Get("perPage")); err == nil && perPageOverride > 0 {
+		perPage = perPageOverride
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	totalPages := (total + perPage - 1) / perPage
+
+	var start, page int
+	if token != "" {
+		position, err := decodeCursor(token)
+		if err != nil {
+			return nil, Pagination{}, newProblem(http.StatusBadRequest, problemInvalidParameter, "Invalid cursor")
+		}
+		if position.Spec != listingSpec(r) {
+			return nil, Pagination{}, newProblem(http.StatusBadRequest, problemInvalidParameter,
+				"The cursor belongs to a listing with a different sort or filters")
+		}
+		start = sort.Search(total, func(i int) bool {
+			return order.compare(sorted[i], position) > 0
+		})
+		page = start/perPage + 1
+	} else {
+		// An invalid page is treated as the first
+		var err error
+		page, err = strconv.Atoi(query.Get("page"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		start = (page - 1) * perPage
+	}
+
+	// Past the last page is empty
+	end := start + perPage
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+
+	pagination := Pagination{Total: total, Page: page, PerPage: perPage, TotalPages: totalPages}
+	if end < total && end > start {
+		pagination.NextCursor = encodeCursor(sorted[end-1], order, listingSpec(r))
+	}
+	w.Header().Set("Link", pageLinks(r, pagination))
+
+	return sorted[start:end], pagination, nil
+}
+
+// listingSpec A hash of what decides the stations listed for r and their order: its
+// path, less the API version, and its query parameters other than those choosing the
+// page and how it is rendered
+func listingSpec(r *http.Request) string {
+	path := r.URL.Path
+	for _, version := range apiVersions {
+		if strings.HasPrefix(path, "/"+version+"/") {
+			path = strings.TrimPrefix(path, "/"+version)
+		}
+	}
+
+	query := r.URL.Query()
+	for _, name := range []string{"page", "perPage", "cursor", "fields", "format"} {
+		query.Del(name)
+	}
+	for _, values := range query {
+		sort.Strings(values)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(path + "?" + query.Encode()))
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// pageLinks RFC 5988 first, prev, next and last links for pagination, relative to r
+func pageLinks(r *http.Request, pagination Pagination) string {
+	link := func(rel string, set map[string]string) string {
+		u := *r.URL
+		query := u.Query()
+		query.Del("page")
+		query.Del("cursor")
+		query.Set("perPage", strconv.Itoa(pagination.PerPage))
+		for k, v := range set {
+			query.Set(k, v)
+		}
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf("<%s>; rel=%q", u.RequestURI(), rel)
+	}
+
+	lastPage := pagination.TotalPages
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	links := []string{link("first", map[string]string{"page": "1"})}
+	if pagination.Page > 1 {
+		prev := pagination.Page - 1
+		if prev > lastPage {
+			prev = lastPage
+		}
+		links = append(links, link("prev", map[string]string{"page": strconv.Itoa(prev)}))
+	}
+	if pagination.NextCursor != "" {
+		if r.URL.Query().Get("cursor") != "" {
+			links = append(links, link("next", map[string]string{"cursor": pagination.NextCursor}))
+		} else {
+			links = append(links, link("next", map[string]string{"page": strconv.Itoa(pagination.Page + 1)}))
+		}
+	}
+	links = append(links, link("last", map[string]string{"page": strconv.Itoa(lastPage)}))
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,206 @@
+// Package pb The Protocol Buffers representations of the station types in the model
+// package and the gRPC station service, generated from stations.proto and
+// service.proto, and conversions between the model types and their messages
+package pb
+
+import (
+	"github.com/jsanc623/NBC/model"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative stations.proto service.proto
+
+// FromStation The protobuf representation of s
+func FromStation(s model.Station) *Station {
+	return &Station{
+		Id:                    int32(s.Id),
+		StationName:           s.StationName,
+		AvailableDocks:        int32(s.AvailableDocks),
+		TotalDocks:            int32(s.TotalDocks),
+		Latitude:              s.Latitude,
+		Longitude:             s.Longitude,
+		StatusValue:           s.StatusValue,
+		StatusKey:             int32(s.StatusKey),
+		AvailableBikes:        int32(s.AvailableBikes),
+		StAddress1:            s.Address1,
+		StAddress2:            s.Address2,
+		City:                  s.City,
+		PostalCode:            s.PostalCode,
+		Location:              s.Location,
+		Altitude:              s.Altitude,
+		TestStation:           s.TestStation,
+		LastCommunicationTime: s.LastCommunicationTime,
+		LandMark:              s.Landmark,
+	}
+}
+
+// Model The model representation of s
+func (s *Station) Model() model.Station {
+	return model.Station{
+		Id:                    int(s.GetId()),
+		StationName:           s.GetStationName(),
+		AvailableDocks:        int(s.GetAvailableDocks()),
+		TotalDocks:            int(s.GetTotalDocks()),
+		Latitude:              s.GetLatitude(),
+		Longitude:             s.GetLongitude(),
+		StatusValue:           s.GetStatusValue(),
+		StatusKey:             int(s.GetStatusKey()),
+		AvailableBikes:        int(s.GetAvailableBikes()),
+		Address1:              s.GetStAddress1(),
+		Address2:              s.GetStAddress2(),
+		City:                  s.GetCity(),
+		PostalCode:            s.GetPostalCode(),
+		Location:              s.GetLocation(),
+		Altitude:              s.GetAltitude(),
+		TestStation:           s.GetTestStation(),
+		LastCommunicationTime: s.GetLastCommunicationTime(),
+		Landmark:              s.GetLandMark(),
+	}
+}
+
+// FromShortStation The protobuf representation of s
+func FromShortStation(s model.ShortStation) *ShortStation {
+	return &ShortStation{
+		StationName:    s.StationName,
+		Address:        s.Address,
+		AvailableDocks: int32(s.AvailableDocks),
+		TotalDocks:     int32(s.TotalDocks),
+		Score:          s.Score,
+	}
+}
+
+// Model The model representation of s
+func (s *ShortStation) Model() model.ShortStation {
+	return model.ShortStation{
+		StationName:    s.GetStationName(),
+		Address:        s.GetAddress(),
+		AvailableDocks: int(s.GetAvailableDocks()),
+		TotalDocks:     int(s.GetTotalDocks()),
+		Score:          s.GetScore(),
+	}
+}
+
+// FromShortStations The protobuf representation of a v1 listing
+func FromShortStations(stations []model.ShortStation) *ShortStationList {
+	list := &ShortStationList{Stations: make([]*ShortStation, 0, len(stations))}
+	for _, station := range stations {
+		list.Stations = append(list.Stations, FromShortStation(station))
+	}
+	return list
+}
+
+// Model The model representation of l
+func (l *ShortStationList) Model() []model.ShortStation {
+	stations := make([]model.ShortStation, 0, len(l.GetStations()))
+	for _, station := range l.GetStations() {
+		stations = append(stations, station.Model())
+	}
+	return stations
+}
+
+// FromBikesToReturn The protobuf representation of b
+func FromBikesToReturn(b model.BikesToReturn) *BikesToReturn {
+	return &BikesToReturn{Dockable: b.Dockable, Message: b.Message}
+}
+
+// Model The model representation of b
+func (b *BikesToReturn) Model() model.BikesToReturn {
+	return model.BikesToReturn{Dockable: b.GetDockable(), Message: b.GetMessage()}
+}
+
+// FromStationDetail The protobuf representation of s
+func FromStationDetail(s model.StationDetail) *StationDetail {
+	return &StationDetail{
+		Id:   int32(s.ID),
+		Name: s.Name,
+		Address: &StationAddress{
+			Street1:    s.Address.Street1,
+			Street2:    s.Address.Street2,
+			City:       s.Address.City,
+			PostalCode: s.Address.PostalCode,
+			Landmark:   s.Address.Landmark,
+		},
+		Location: &StationLocation{
+			Latitude:  s.Location.Latitude,
+			Longitude: s.Location.Longitude,
+			Altitude:  s.Location.Altitude,
+		},
+		Status: &StationStatus{
+			Key:       int32(s.Status.Key),
+			Value:     s.Status.Value,
+			InService: s.Status.InService,
+		},
+		AvailableBikes:        int32(s.AvailableBikes),
+		AvailableDocks:        int32(s.AvailableDocks),
+		TotalDocks:            int32(s.TotalDocks),
+		TestStation:           s.TestStation,
+		LastCommunicationTime: s.LastCommunicationTime,
+		Distance:              s.Distance,
+		Score:                 s.Score,
+	}
+}
+
+// Model The model representation of s
+func (s *StationDetail) Model() model.StationDetail {
+	return model.StationDetail{
+		ID:   int(s.GetId()),
+		Name: s.GetName(),
+		Address: model.StationAddress{
+			Street1:    s.GetAddress().GetStreet1(),
+			Street2:    s.GetAddress().GetStreet2(),
+			City:       s.GetAddress().GetCity(),
+			PostalCode: s.GetAddress().GetPostalCode(),
+			Landmark:   s.GetAddress().GetLandmark(),
+		},
+		Location: model.StationLocation{
+			Latitude:  s.GetLocation().GetLatitude(),
+			Longitude: s.GetLocation().GetLongitude(),
+			Altitude:  s.GetLocation().GetAltitude(),
+		},
+		Status: model.StationStatus{
+			Key:       int(s.GetStatus().GetKey()),
+			Value:     s.GetStatus().GetValue(),
+			InService: s.GetStatus().GetInService(),
+		},
+		AvailableBikes:        int(s.GetAvailableBikes()),
+		AvailableDocks:        int(s.GetAvailableDocks()),
+		TotalDocks:            int(s.GetTotalDocks()),
+		TestStation:           s.GetTestStation(),
+		LastCommunicationTime: s.GetLastCommunicationTime(),
+		Distance:              s.GetDistance(),
+		Score:                 s.GetScore(),
+	}
+}
+
+// FromStationPage The protobuf representation of a v2 listing
+func FromStationPage(page model.StationPage) *StationPage {
+	out := &StationPage{
+		Stations:   make([]*StationDetail, 0, len(page.Stations)),
+		Total:      int32(page.Total),
+		Page:       int32(page.Page),
+		PerPage:    int32(page.PerPage),
+		TotalPages: int32(page.TotalPages),
+		NextCursor: page.NextCursor,
+	}
+	for _, station := range page.Stations {
+		out.Stations = append(out.Stations, FromStationDetail(station))
+	}
+	return out
+}
+
+// Model The model representation of p
+func (p *StationPage) Model() model.StationPage {
+	page := model.StationPage{
+		Stations: make([]model.StationDetail, 0, len(p.GetStations())),
+		Pagination: model.Pagination{
+			Total:      int(p.GetTotal()),
+			Page:       int(p.GetPage()),
+			PerPage:    int(p.GetPerPage()),
+			TotalPages: int(p.GetTotalPages()),
+			NextCursor: p.GetNextCursor(),
+		},
+	}
+	for _, station := range p.GetStations() {
+		page.Stations = append(page.Stations, station.Model())
+	}
+	return page
+}
@@ -0,0 +1,542 @@
+// The gRPC station service. It serves the same snapshot as the REST API, and
+// filters and sorts take the same names as the REST query parameters.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: service.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A filter as accepted by the REST listings: status, minBikes, minDocks or any
+// Station field by its JSON name. A station matching any of the values passes
+type Filter struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Values        []string               `protobuf:"bytes,2,rep,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Filter) Reset() {
+	*x = Filter{}
+	mi := &file_service_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Filter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Filter) ProtoMessage() {}
+
+func (x *Filter) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Filter.ProtoReflect.Descriptor instead.
+func (*Filter) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Filter) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Filter) GetValues() []string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+type ListStationsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Combined with AND
+	Filters []*Filter `protobuf:"bytes,1,rep,name=filters,proto3" json:"filters,omitempty"`
+	// Station fields by JSON name, prefixed with "-" for descending. By ID if empty
+	Sort          []string `protobuf:"bytes,2,rep,name=sort,proto3" json:"sort,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListStationsRequest) Reset() {
+	*x = ListStationsRequest{}
+	mi := &file_service_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListStationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListStationsRequest) ProtoMessage() {}
+
+func (x *ListStationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListStationsRequest.ProtoReflect.Descriptor instead.
+func (*ListStationsRequest) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListStationsRequest) GetFilters() []*Filter {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *ListStationsRequest) GetSort() []string {
+	if x != nil {
+		return x.Sort
+	}
+	return nil
+}
+
+type GetStationRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetStationRequest) Reset() {
+	*x = GetStationRequest{}
+	mi := &file_service_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetStationRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetStationRequest) ProtoMessage() {}
+
+func (x *GetStationRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetStationRequest.ProtoReflect.Descriptor instead.
+func (*GetStationRequest) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetStationRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+type SearchStationsRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Query   string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	Filters []*Filter              `protobuf:"bytes,2,rep,name=filters,proto3" json:"filters,omitempty"`
+	// At most this many results, all of them if 0
+	Limit         int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchStationsRequest) Reset() {
+	*x = SearchStationsRequest{}
+	mi := &file_service_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchStationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchStationsRequest) ProtoMessage() {}
+
+func (x *SearchStationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchStationsRequest.ProtoReflect.Descriptor instead.
+func (*SearchStationsRequest) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SearchStationsRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchStationsRequest) GetFilters() []*Filter {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+func (x *SearchStationsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type SearchStationsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Each with its score
+	Stations      []*StationDetail `protobuf:"bytes,1,rep,name=stations,proto3" json:"stations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchStationsResponse) Reset() {
+	*x = SearchStationsResponse{}
+	mi := &file_service_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchStationsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchStationsResponse) ProtoMessage() {}
+
+func (x *SearchStationsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchStationsResponse.ProtoReflect.Descriptor instead.
+func (*SearchStationsResponse) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SearchStationsResponse) GetStations() []*StationDetail {
+	if x != nil {
+		return x.Stations
+	}
+	return nil
+}
+
+type CheckDockableRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StationId     int32                  `protobuf:"varint,1,opt,name=station_id,json=stationId,proto3" json:"station_id,omitempty"`
+	BikesToReturn int32                  `protobuf:"varint,2,opt,name=bikes_to_return,json=bikesToReturn,proto3" json:"bikes_to_return,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckDockableRequest) Reset() {
+	*x = CheckDockableRequest{}
+	mi := &file_service_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckDockableRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckDockableRequest) ProtoMessage() {}
+
+func (x *CheckDockableRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckDockableRequest.ProtoReflect.Descriptor instead.
+func (*CheckDockableRequest) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *CheckDockableRequest) GetStationId() int32 {
+	if x != nil {
+		return x.StationId
+	}
+	return 0
+}
+
+func (x *CheckDockableRequest) GetBikesToReturn() int32 {
+	if x != nil {
+		return x.BikesToReturn
+	}
+	return 0
+}
+
+type WatchStationsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Filters       []*Filter              `protobuf:"bytes,1,rep,name=filters,proto3" json:"filters,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchStationsRequest) Reset() {
+	*x = WatchStationsRequest{}
+	mi := &file_service_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchStationsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchStationsRequest) ProtoMessage() {}
+
+func (x *WatchStationsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchStationsRequest.ProtoReflect.Descriptor instead.
+func (*WatchStationsRequest) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WatchStationsRequest) GetFilters() []*Filter {
+	if x != nil {
+		return x.Filters
+	}
+	return nil
+}
+
+// A station that was added or changed, or that has been removed from the
+// feed or no longer matches the filters
+type StationUpdate struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Station       *StationDetail         `protobuf:"bytes,1,opt,name=station,proto3" json:"station,omitempty"`
+	Removed       bool                   `protobuf:"varint,2,opt,name=removed,proto3" json:"removed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationUpdate) Reset() {
+	*x = StationUpdate{}
+	mi := &file_service_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationUpdate) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationUpdate) ProtoMessage() {}
+
+func (x *StationUpdate) ProtoReflect() protoreflect.Message {
+	mi := &file_service_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationUpdate.ProtoReflect.Descriptor instead.
+func (*StationUpdate) Descriptor() ([]byte, []int) {
+	return file_service_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StationUpdate) GetStation() *StationDetail {
+	if x != nil {
+		return x.Station
+	}
+	return nil
+}
+
+func (x *StationUpdate) GetRemoved() bool {
+	if x != nil {
+		return x.Removed
+	}
+	return false
+}
+
+var File_service_proto protoreflect.FileDescriptor
+
+const file_service_proto_rawDesc = "" +
+	"\n" +
+	"\rservice.proto\x12\x06nbc.v1\x1a\x0estations.proto\"4\n" +
+	"\x06Filter\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06values\x18\x02 \x03(\tR\x06values\"S\n" +
+	"\x13ListStationsRequest\x12(\n" +
+	"\afilters\x18\x01 \x03(\v2\x0e.nbc.v1.FilterR\afilters\x12\x12\n" +
+	"\x04sort\x18\x02 \x03(\tR\x04sort\"#\n" +
+	"\x11GetStationRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\"m\n" +
+	"\x15SearchStationsRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12(\n" +
+	"\afilters\x18\x02 \x03(\v2\x0e.nbc.v1.FilterR\afilters\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\"K\n" +
+	"\x16SearchStationsResponse\x121\n" +
+	"\bstations\x18\x01 \x03(\v2\x15.nbc.v1.StationDetailR\bstations\"]\n" +
+	"\x14CheckDockableRequest\x12\x1d\n" +
+	"\n" +
+	"station_id\x18\x01 \x01(\x05R\tstationId\x12&\n" +
+	"\x0fbikes_to_return\x18\x02 \x01(\x05R\rbikesToReturn\"@\n" +
+	"\x14WatchStationsRequest\x12(\n" +
+	"\afilters\x18\x01 \x03(\v2\x0e.nbc.v1.FilterR\afilters\"Z\n" +
+	"\rStationUpdate\x12/\n" +
+	"\astation\x18\x01 \x01(\v2\x15.nbc.v1.StationDetailR\astation\x12\x18\n" +
+	"\aremoved\x18\x02 \x01(\bR\aremoved2\xef\x02\n" +
+	"\bStations\x12D\n" +
+	"\fListStations\x12\x1b.nbc.v1.ListStationsRequest\x1a\x15.nbc.v1.StationDetail0\x01\x12>\n" +
+	"\n" +
+	"GetStation\x12\x19.nbc.v1.GetStationRequest\x1a\x15.nbc.v1.StationDetail\x12O\n" +
+	"\x0eSearchStations\x12\x1d.nbc.v1.SearchStationsRequest\x1a\x1e.nbc.v1.SearchStationsResponse\x12D\n" +
+	"\rCheckDockable\x12\x1c.nbc.v1.CheckDockableRequest\x1a\x15.nbc.v1.BikesToReturn\x12F\n" +
+	"\rWatchStations\x12\x1c.nbc.v1.WatchStationsRequest\x1a\x15.nbc.v1.StationUpdate0\x01B\x1cZ\x1agithub.com/jsanc623/NBC/pbb\x06proto3"
+
+var (
+	file_service_proto_rawDescOnce sync.Once
+	file_service_proto_rawDescData []byte
+)
+
+func file_service_proto_rawDescGZIP() []byte {
+	file_service_proto_rawDescOnce.Do(func() {
+		file_service_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_service_proto_rawDesc), len(file_service_proto_rawDesc)))
+	})
+	return file_service_proto_rawDescData
+}
+
+var file_service_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_service_proto_goTypes = []any{
+	(*Filter)(nil),                 // 0: nbc.v1.Filter
+	(*ListStationsRequest)(nil),    // 1: nbc.v1.ListStationsRequest
+	(*GetStationRequest)(nil),      // 2: nbc.v1.GetStationRequest
+	(*SearchStationsRequest)(nil),  // 3: nbc.v1.SearchStationsRequest
+	(*SearchStationsResponse)(nil), // 4: nbc.v1.SearchStationsResponse
+	(*CheckDockableRequest)(nil),   // 5: nbc.v1.CheckDockableRequest
+	(*WatchStationsRequest)(nil),   // 6: nbc.v1.WatchStationsRequest
+	(*StationUpdate)(nil),          // 7: nbc.v1.StationUpdate
+	(*StationDetail)(nil),          // 8: nbc.v1.StationDetail
+	(*BikesToReturn)(nil),          // 9: nbc.v1.BikesToReturn
+}
+var file_service_proto_depIdxs = []int32{
+	0,  // 0: nbc.v1.ListStationsRequest.filters:type_name -> nbc.v1.Filter
+	0,  // 1: nbc.v1.SearchStationsRequest.filters:type_name -> nbc.v1.Filter
+	8,  // 2: nbc.v1.SearchStationsResponse.stations:type_name -> nbc.v1.StationDetail
+	0,  // 3: nbc.v1.WatchStationsRequest.filters:type_name -> nbc.v1.Filter
+	8,  // 4: nbc.v1.StationUpdate.station:type_name -> nbc.v1.StationDetail
+	1,  // 5: nbc.v1.Stations.ListStations:input_type -> nbc.v1.ListStationsRequest
+	2,  // 6: nbc.v1.Stations.GetStation:input_type -> nbc.v1.GetStationRequest
+	3,  // 7: nbc.v1.Stations.SearchStations:input_type -> nbc.v1.SearchStationsRequest
+	5,  // 8: nbc.v1.Stations.CheckDockable:input_type -> nbc.v1.CheckDockableRequest
+	6,  // 9: nbc.v1.Stations.WatchStations:input_type -> nbc.v1.WatchStationsRequest
+	8,  // 10: nbc.v1.Stations.ListStations:output_type -> nbc.v1.StationDetail
+	8,  // 11: nbc.v1.Stations.GetStation:output_type -> nbc.v1.StationDetail
+	4,  // 12: nbc.v1.Stations.SearchStations:output_type -> nbc.v1.SearchStationsResponse
+	9,  // 13: nbc.v1.Stations.CheckDockable:output_type -> nbc.v1.BikesToReturn
+	7,  // 14: nbc.v1.Stations.WatchStations:output_type -> nbc.v1.StationUpdate
+	10, // [10:15] is the sub-list for method output_type
+	5,  // [5:10] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_service_proto_init() }
+func file_service_proto_init() {
+	if File_service_proto != nil {
+		return
+	}
+	file_stations_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_service_proto_rawDesc), len(file_service_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_service_proto_goTypes,
+		DependencyIndexes: file_service_proto_depIdxs,
+		MessageInfos:      file_service_proto_msgTypes,
+	}.Build()
+	File_service_proto = out.File
+	file_service_proto_goTypes = nil
+	file_service_proto_depIdxs = nil
+}
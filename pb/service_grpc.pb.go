@@ -0,0 +1,299 @@
+// The gRPC station service. It serves the same snapshot as the REST API, and
+// filters and sorts take the same names as the REST query parameters.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: service.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Stations_ListStations_FullMethodName   = "/nbc.v1.Stations/ListStations"
+	Stations_GetStation_FullMethodName     = "/nbc.v1.Stations/GetStation"
+	Stations_SearchStations_FullMethodName = "/nbc.v1.Stations/SearchStations"
+	Stations_CheckDockable_FullMethodName  = "/nbc.v1.Stations/CheckDockable"
+	Stations_WatchStations_FullMethodName  = "/nbc.v1.Stations/WatchStations"
+)
+
+// StationsClient is the client API for Stations service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Stations Lists, searches and watches CitiBike stations
+type StationsClient interface {
+	// Streams every station matching the filters, in the order asked for
+	ListStations(ctx context.Context, in *ListStationsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StationDetail], error)
+	// Gets a station by ID
+	GetStation(ctx context.Context, in *GetStationRequest, opts ...grpc.CallOption) (*StationDetail, error)
+	// Ranked, typo-tolerant search of station names and addresses, best first
+	SearchStations(ctx context.Context, in *SearchStationsRequest, opts ...grpc.CallOption) (*SearchStationsResponse, error)
+	// Whether a station has enough docks to return bikes
+	CheckDockable(ctx context.Context, in *CheckDockableRequest, opts ...grpc.CallOption) (*BikesToReturn, error)
+	// Streams the stations matching the filters, then each change to them as the
+	// snapshot is refreshed
+	WatchStations(ctx context.Context, in *WatchStationsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StationUpdate], error)
+}
+
+type stationsClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewStationsClient(cc grpc.ClientConnInterface) StationsClient {
+	return &stationsClient{cc}
+}
+
+func (c *stationsClient) ListStations(ctx context.Context, in *ListStationsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StationDetail], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Stations_ServiceDesc.Streams[0], Stations_ListStations_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListStationsRequest, StationDetail]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Stations_ListStationsClient = grpc.ServerStreamingClient[StationDetail]
+
+func (c *stationsClient) GetStation(ctx context.Context, in *GetStationRequest, opts ...grpc.CallOption) (*StationDetail, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StationDetail)
+	err := c.cc.Invoke(ctx, Stations_GetStation_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stationsClient) SearchStations(ctx context.Context, in *SearchStationsRequest, opts ...grpc.CallOption) (*SearchStationsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SearchStationsResponse)
+	err := c.cc.Invoke(ctx, Stations_SearchStations_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stationsClient) CheckDockable(ctx context.Context, in *CheckDockableRequest, opts ...grpc.CallOption) (*BikesToReturn, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BikesToReturn)
+	err := c.cc.Invoke(ctx, Stations_CheckDockable_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *stationsClient) WatchStations(ctx context.Context, in *WatchStationsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StationUpdate], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Stations_ServiceDesc.Streams[1], Stations_WatchStations_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchStationsRequest, StationUpdate]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Stations_WatchStationsClient = grpc.ServerStreamingClient[StationUpdate]
+
+// StationsServer is the server API for Stations service.
+// All implementations must embed UnimplementedStationsServer
+// for forward compatibility.
+//
+// Stations Lists, searches and watches CitiBike stations
+type StationsServer interface {
+	// Streams every station matching the filters, in the order asked for
+	ListStations(*ListStationsRequest, grpc.ServerStreamingServer[StationDetail]) error
+	// Gets a station by ID
+	GetStation(context.Context, *GetStationRequest) (*StationDetail, error)
+	// Ranked, typo-tolerant search of station names and addresses, best first
+	SearchStations(context.Context, *SearchStationsRequest) (*SearchStationsResponse, error)
+	// Whether a station has enough docks to return bikes
+	CheckDockable(context.Context, *CheckDockableRequest) (*BikesToReturn, error)
+	// Streams the stations matching the filters, then each change to them as the
+	// snapshot is refreshed
+	WatchStations(*WatchStationsRequest, grpc.ServerStreamingServer[StationUpdate]) error
+	mustEmbedUnimplementedStationsServer()
+}
+
+// UnimplementedStationsServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedStationsServer struct{}
+
+func (UnimplementedStationsServer) ListStations(*ListStationsRequest, grpc.ServerStreamingServer[StationDetail]) error {
+	return status.Errorf(codes.Unimplemented, "method ListStations not implemented")
+}
+func (UnimplementedStationsServer) GetStation(context.Context, *GetStationRequest) (*StationDetail, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetStation not implemented")
+}
+func (UnimplementedStationsServer) SearchStations(context.Context, *SearchStationsRequest) (*SearchStationsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SearchStations not implemented")
+}
+func (UnimplementedStationsServer) CheckDockable(context.Context, *CheckDockableRequest) (*BikesToReturn, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckDockable not implemented")
+}
+func (UnimplementedStationsServer) WatchStations(*WatchStationsRequest, grpc.ServerStreamingServer[StationUpdate]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchStations not implemented")
+}
+func (UnimplementedStationsServer) mustEmbedUnimplementedStationsServer() {}
+func (UnimplementedStationsServer) testEmbeddedByValue()                  {}
+
+// UnsafeStationsServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to StationsServer will
+// result in compilation errors.
+type UnsafeStationsServer interface {
+	mustEmbedUnimplementedStationsServer()
+}
+
+func RegisterStationsServer(s grpc.ServiceRegistrar, srv StationsServer) {
+	// If the following call pancis, it indicates UnimplementedStationsServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Stations_ServiceDesc, srv)
+}
+
+func _Stations_ListStations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListStationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StationsServer).ListStations(m, &grpc.GenericServerStream[ListStationsRequest, StationDetail]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Stations_ListStationsServer = grpc.ServerStreamingServer[StationDetail]
+
+func _Stations_GetStation_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStationRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StationsServer).GetStation(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Stations_GetStation_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StationsServer).GetStation(ctx, req.(*GetStationRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stations_SearchStations_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchStationsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StationsServer).SearchStations(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Stations_SearchStations_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StationsServer).SearchStations(ctx, req.(*SearchStationsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stations_CheckDockable_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckDockableRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StationsServer).CheckDockable(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Stations_CheckDockable_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StationsServer).CheckDockable(ctx, req.(*CheckDockableRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Stations_WatchStations_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchStationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StationsServer).WatchStations(m, &grpc.GenericServerStream[WatchStationsRequest, StationUpdate]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Stations_WatchStationsServer = grpc.ServerStreamingServer[StationUpdate]
+
+// Stations_ServiceDesc is the grpc.ServiceDesc for Stations service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Stations_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "nbc.v1.Stations",
+	HandlerType: (*StationsServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStation",
+			Handler:    _Stations_GetStation_Handler,
+		},
+		{
+			MethodName: "SearchStations",
+			Handler:    _Stations_SearchStations_Handler,
+		},
+		{
+			MethodName: "CheckDockable",
+			Handler:    _Stations_CheckDockable_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListStations",
+			Handler:       _Stations_ListStations_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "WatchStations",
+			Handler:       _Stations_WatchStations_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "service.proto",
+}
@@ -0,0 +1,946 @@
+// Protocol Buffers representations of the station types in
+// github.com/jsanc623/NBC/model. Field names match the JSON representation, so
+// their JSON names are the same as the API's.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: stations.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// A station as published in the CitiBike feed
+type Station struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	Id                    int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	StationName           string                 `protobuf:"bytes,2,opt,name=station_name,json=stationName,proto3" json:"station_name,omitempty"`
+	AvailableDocks        int32                  `protobuf:"varint,3,opt,name=available_docks,json=availableDocks,proto3" json:"available_docks,omitempty"`
+	TotalDocks            int32                  `protobuf:"varint,4,opt,name=total_docks,json=totalDocks,proto3" json:"total_docks,omitempty"`
+	Latitude              float64                `protobuf:"fixed64,5,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude             float64                `protobuf:"fixed64,6,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	StatusValue           string                 `protobuf:"bytes,7,opt,name=status_value,json=statusValue,proto3" json:"status_value,omitempty"`
+	StatusKey             int32                  `protobuf:"varint,8,opt,name=status_key,json=statusKey,proto3" json:"status_key,omitempty"`
+	AvailableBikes        int32                  `protobuf:"varint,9,opt,name=available_bikes,json=availableBikes,proto3" json:"available_bikes,omitempty"`
+	StAddress1            string                 `protobuf:"bytes,10,opt,name=st_address1,json=stAddress1,proto3" json:"st_address1,omitempty"`
+	StAddress2            string                 `protobuf:"bytes,11,opt,name=st_address2,json=stAddress2,proto3" json:"st_address2,omitempty"`
+	City                  string                 `protobuf:"bytes,12,opt,name=city,proto3" json:"city,omitempty"`
+	PostalCode            string                 `protobuf:"bytes,13,opt,name=postal_code,json=postalCode,proto3" json:"postal_code,omitempty"`
+	Location              string                 `protobuf:"bytes,14,opt,name=location,proto3" json:"location,omitempty"`
+	Altitude              string                 `protobuf:"bytes,15,opt,name=altitude,proto3" json:"altitude,omitempty"`
+	TestStation           bool                   `protobuf:"varint,16,opt,name=test_station,json=testStation,proto3" json:"test_station,omitempty"`
+	LastCommunicationTime string                 `protobuf:"bytes,17,opt,name=last_communication_time,json=lastCommunicationTime,proto3" json:"last_communication_time,omitempty"`
+	LandMark              string                 `protobuf:"bytes,18,opt,name=land_mark,json=landMark,proto3" json:"land_mark,omitempty"`
+	unknownFields         protoimpl.UnknownFields
+	sizeCache             protoimpl.SizeCache
+}
+
+func (x *Station) Reset() {
+	*x = Station{}
+	mi := &file_stations_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Station) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Station) ProtoMessage() {}
+
+func (x *Station) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Station.ProtoReflect.Descriptor instead.
+func (*Station) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Station) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Station) GetStationName() string {
+	if x != nil {
+		return x.StationName
+	}
+	return ""
+}
+
+func (x *Station) GetAvailableDocks() int32 {
+	if x != nil {
+		return x.AvailableDocks
+	}
+	return 0
+}
+
+func (x *Station) GetTotalDocks() int32 {
+	if x != nil {
+		return x.TotalDocks
+	}
+	return 0
+}
+
+func (x *Station) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *Station) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *Station) GetStatusValue() string {
+	if x != nil {
+		return x.StatusValue
+	}
+	return ""
+}
+
+func (x *Station) GetStatusKey() int32 {
+	if x != nil {
+		return x.StatusKey
+	}
+	return 0
+}
+
+func (x *Station) GetAvailableBikes() int32 {
+	if x != nil {
+		return x.AvailableBikes
+	}
+	return 0
+}
+
+func (x *Station) GetStAddress1() string {
+	if x != nil {
+		return x.StAddress1
+	}
+	return ""
+}
+
+func (x *Station) GetStAddress2() string {
+	if x != nil {
+		return x.StAddress2
+	}
+	return ""
+}
+
+func (x *Station) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *Station) GetPostalCode() string {
+	if x != nil {
+		return x.PostalCode
+	}
+	return ""
+}
+
+func (x *Station) GetLocation() string {
+	if x != nil {
+		return x.Location
+	}
+	return ""
+}
+
+func (x *Station) GetAltitude() string {
+	if x != nil {
+		return x.Altitude
+	}
+	return ""
+}
+
+func (x *Station) GetTestStation() bool {
+	if x != nil {
+		return x.TestStation
+	}
+	return false
+}
+
+func (x *Station) GetLastCommunicationTime() string {
+	if x != nil {
+		return x.LastCommunicationTime
+	}
+	return ""
+}
+
+func (x *Station) GetLandMark() string {
+	if x != nil {
+		return x.LandMark
+	}
+	return ""
+}
+
+// The v1 station representation
+type ShortStation struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	StationName    string                 `protobuf:"bytes,1,opt,name=station_name,json=stationName,proto3" json:"station_name,omitempty"`
+	Address        string                 `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	AvailableDocks int32                  `protobuf:"varint,3,opt,name=available_docks,json=availableDocks,proto3" json:"available_docks,omitempty"`
+	TotalDocks     int32                  `protobuf:"varint,4,opt,name=total_docks,json=totalDocks,proto3" json:"total_docks,omitempty"`
+	// Set, from 0 to 1, by searches
+	Score         float64 `protobuf:"fixed64,5,opt,name=score,proto3" json:"score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShortStation) Reset() {
+	*x = ShortStation{}
+	mi := &file_stations_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShortStation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShortStation) ProtoMessage() {}
+
+func (x *ShortStation) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShortStation.ProtoReflect.Descriptor instead.
+func (*ShortStation) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ShortStation) GetStationName() string {
+	if x != nil {
+		return x.StationName
+	}
+	return ""
+}
+
+func (x *ShortStation) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *ShortStation) GetAvailableDocks() int32 {
+	if x != nil {
+		return x.AvailableDocks
+	}
+	return 0
+}
+
+func (x *ShortStation) GetTotalDocks() int32 {
+	if x != nil {
+		return x.TotalDocks
+	}
+	return 0
+}
+
+func (x *ShortStation) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+// A v1 station listing
+type ShortStationList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stations      []*ShortStation        `protobuf:"bytes,1,rep,name=stations,proto3" json:"stations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShortStationList) Reset() {
+	*x = ShortStationList{}
+	mi := &file_stations_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShortStationList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShortStationList) ProtoMessage() {}
+
+func (x *ShortStationList) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShortStationList.ProtoReflect.Descriptor instead.
+func (*ShortStationList) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ShortStationList) GetStations() []*ShortStation {
+	if x != nil {
+		return x.Stations
+	}
+	return nil
+}
+
+// Whether bikes can be docked at a station
+type BikesToReturn struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Dockable      bool                   `protobuf:"varint,1,opt,name=dockable,proto3" json:"dockable,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BikesToReturn) Reset() {
+	*x = BikesToReturn{}
+	mi := &file_stations_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BikesToReturn) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BikesToReturn) ProtoMessage() {}
+
+func (x *BikesToReturn) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BikesToReturn.ProtoReflect.Descriptor instead.
+func (*BikesToReturn) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *BikesToReturn) GetDockable() bool {
+	if x != nil {
+		return x.Dockable
+	}
+	return false
+}
+
+func (x *BikesToReturn) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// The v2 station representation
+type StationDetail struct {
+	state                 protoimpl.MessageState `protogen:"open.v1"`
+	Id                    int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name                  string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Address               *StationAddress        `protobuf:"bytes,3,opt,name=address,proto3" json:"address,omitempty"`
+	Location              *StationLocation       `protobuf:"bytes,4,opt,name=location,proto3" json:"location,omitempty"`
+	Status                *StationStatus         `protobuf:"bytes,5,opt,name=status,proto3" json:"status,omitempty"`
+	AvailableBikes        int32                  `protobuf:"varint,6,opt,name=available_bikes,json=availableBikes,proto3" json:"available_bikes,omitempty"`
+	AvailableDocks        int32                  `protobuf:"varint,7,opt,name=available_docks,json=availableDocks,proto3" json:"available_docks,omitempty"`
+	TotalDocks            int32                  `protobuf:"varint,8,opt,name=total_docks,json=totalDocks,proto3" json:"total_docks,omitempty"`
+	TestStation           bool                   `protobuf:"varint,9,opt,name=test_station,json=testStation,proto3" json:"test_station,omitempty"`
+	LastCommunicationTime string                 `protobuf:"bytes,10,opt,name=last_communication_time,json=lastCommunicationTime,proto3" json:"last_communication_time,omitempty"`
+	// Set, in meters, by queries near a point
+	Distance float64 `protobuf:"fixed64,11,opt,name=distance,proto3" json:"distance,omitempty"`
+	// Set, from 0 to 1, by searches
+	Score         float64 `protobuf:"fixed64,12,opt,name=score,proto3" json:"score,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationDetail) Reset() {
+	*x = StationDetail{}
+	mi := &file_stations_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationDetail) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationDetail) ProtoMessage() {}
+
+func (x *StationDetail) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationDetail.ProtoReflect.Descriptor instead.
+func (*StationDetail) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *StationDetail) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *StationDetail) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *StationDetail) GetAddress() *StationAddress {
+	if x != nil {
+		return x.Address
+	}
+	return nil
+}
+
+func (x *StationDetail) GetLocation() *StationLocation {
+	if x != nil {
+		return x.Location
+	}
+	return nil
+}
+
+func (x *StationDetail) GetStatus() *StationStatus {
+	if x != nil {
+		return x.Status
+	}
+	return nil
+}
+
+func (x *StationDetail) GetAvailableBikes() int32 {
+	if x != nil {
+		return x.AvailableBikes
+	}
+	return 0
+}
+
+func (x *StationDetail) GetAvailableDocks() int32 {
+	if x != nil {
+		return x.AvailableDocks
+	}
+	return 0
+}
+
+func (x *StationDetail) GetTotalDocks() int32 {
+	if x != nil {
+		return x.TotalDocks
+	}
+	return 0
+}
+
+func (x *StationDetail) GetTestStation() bool {
+	if x != nil {
+		return x.TestStation
+	}
+	return false
+}
+
+func (x *StationDetail) GetLastCommunicationTime() string {
+	if x != nil {
+		return x.LastCommunicationTime
+	}
+	return ""
+}
+
+func (x *StationDetail) GetDistance() float64 {
+	if x != nil {
+		return x.Distance
+	}
+	return 0
+}
+
+func (x *StationDetail) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+// The postal address of a station
+type StationAddress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Street1       string                 `protobuf:"bytes,1,opt,name=street1,proto3" json:"street1,omitempty"`
+	Street2       string                 `protobuf:"bytes,2,opt,name=street2,proto3" json:"street2,omitempty"`
+	City          string                 `protobuf:"bytes,3,opt,name=city,proto3" json:"city,omitempty"`
+	PostalCode    string                 `protobuf:"bytes,4,opt,name=postal_code,json=postalCode,proto3" json:"postal_code,omitempty"`
+	Landmark      string                 `protobuf:"bytes,5,opt,name=landmark,proto3" json:"landmark,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationAddress) Reset() {
+	*x = StationAddress{}
+	mi := &file_stations_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationAddress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationAddress) ProtoMessage() {}
+
+func (x *StationAddress) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationAddress.ProtoReflect.Descriptor instead.
+func (*StationAddress) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StationAddress) GetStreet1() string {
+	if x != nil {
+		return x.Street1
+	}
+	return ""
+}
+
+func (x *StationAddress) GetStreet2() string {
+	if x != nil {
+		return x.Street2
+	}
+	return ""
+}
+
+func (x *StationAddress) GetCity() string {
+	if x != nil {
+		return x.City
+	}
+	return ""
+}
+
+func (x *StationAddress) GetPostalCode() string {
+	if x != nil {
+		return x.PostalCode
+	}
+	return ""
+}
+
+func (x *StationAddress) GetLandmark() string {
+	if x != nil {
+		return x.Landmark
+	}
+	return ""
+}
+
+// The coordinates of a station
+type StationLocation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Latitude      float64                `protobuf:"fixed64,1,opt,name=latitude,proto3" json:"latitude,omitempty"`
+	Longitude     float64                `protobuf:"fixed64,2,opt,name=longitude,proto3" json:"longitude,omitempty"`
+	Altitude      string                 `protobuf:"bytes,3,opt,name=altitude,proto3" json:"altitude,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationLocation) Reset() {
+	*x = StationLocation{}
+	mi := &file_stations_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationLocation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationLocation) ProtoMessage() {}
+
+func (x *StationLocation) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationLocation.ProtoReflect.Descriptor instead.
+func (*StationLocation) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StationLocation) GetLatitude() float64 {
+	if x != nil {
+		return x.Latitude
+	}
+	return 0
+}
+
+func (x *StationLocation) GetLongitude() float64 {
+	if x != nil {
+		return x.Longitude
+	}
+	return 0
+}
+
+func (x *StationLocation) GetAltitude() string {
+	if x != nil {
+		return x.Altitude
+	}
+	return ""
+}
+
+// The service status of a station
+type StationStatus struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           int32                  `protobuf:"varint,1,opt,name=key,proto3" json:"key,omitempty"`
+	Value         string                 `protobuf:"bytes,2,opt,name=value,proto3" json:"value,omitempty"`
+	InService     bool                   `protobuf:"varint,3,opt,name=in_service,json=inService,proto3" json:"in_service,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationStatus) Reset() {
+	*x = StationStatus{}
+	mi := &file_stations_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationStatus) ProtoMessage() {}
+
+func (x *StationStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationStatus.ProtoReflect.Descriptor instead.
+func (*StationStatus) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StationStatus) GetKey() int32 {
+	if x != nil {
+		return x.Key
+	}
+	return 0
+}
+
+func (x *StationStatus) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *StationStatus) GetInService() bool {
+	if x != nil {
+		return x.InService
+	}
+	return false
+}
+
+// A page of a v2 station listing
+type StationPage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Stations      []*StationDetail       `protobuf:"bytes,1,rep,name=stations,proto3" json:"stations,omitempty"`
+	Total         int32                  `protobuf:"varint,2,opt,name=total,proto3" json:"total,omitempty"`
+	Page          int32                  `protobuf:"varint,3,opt,name=page,proto3" json:"page,omitempty"`
+	PerPage       int32                  `protobuf:"varint,4,opt,name=per_page,json=perPage,proto3" json:"per_page,omitempty"`
+	TotalPages    int32                  `protobuf:"varint,5,opt,name=total_pages,json=totalPages,proto3" json:"total_pages,omitempty"`
+	NextCursor    string                 `protobuf:"bytes,6,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StationPage) Reset() {
+	*x = StationPage{}
+	mi := &file_stations_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StationPage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StationPage) ProtoMessage() {}
+
+func (x *StationPage) ProtoReflect() protoreflect.Message {
+	mi := &file_stations_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StationPage.ProtoReflect.Descriptor instead.
+func (*StationPage) Descriptor() ([]byte, []int) {
+	return file_stations_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StationPage) GetStations() []*StationDetail {
+	if x != nil {
+		return x.Stations
+	}
+	return nil
+}
+
+func (x *StationPage) GetTotal() int32 {
+	if x != nil {
+		return x.Total
+	}
+	return 0
+}
+
+func (x *StationPage) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *StationPage) GetPerPage() int32 {
+	if x != nil {
+		return x.PerPage
+	}
+	return 0
+}
+
+func (x *StationPage) GetTotalPages() int32 {
+	if x != nil {
+		return x.TotalPages
+	}
+	return 0
+}
+
+func (x *StationPage) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+var File_stations_proto protoreflect.FileDescriptor
+
+const file_stations_proto_rawDesc = "" +
+	"\n" +
+	"\x0estations.proto\x12\x06nbc.v1\"\xd2\x04\n" +
+	"\aStation\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12!\n" +
+	"\fstation_name\x18\x02 \x01(\tR\vstationName\x12'\n" +
+	"\x0favailable_docks\x18\x03 \x01(\x05R\x0eavailableDocks\x12\x1f\n" +
+	"\vtotal_docks\x18\x04 \x01(\x05R\n" +
+	"totalDocks\x12\x1a\n" +
+	"\blatitude\x18\x05 \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\x06 \x01(\x01R\tlongitude\x12!\n" +
+	"\fstatus_value\x18\a \x01(\tR\vstatusValue\x12\x1d\n" +
+	"\n" +
+	"status_key\x18\b \x01(\x05R\tstatusKey\x12'\n" +
+	"\x0favailable_bikes\x18\t \x01(\x05R\x0eavailableBikes\x12\x1f\n" +
+	"\vst_address1\x18\n" +
+	" \x01(\tR\n" +
+	"stAddress1\x12\x1f\n" +
+	"\vst_address2\x18\v \x01(\tR\n" +
+	"stAddress2\x12\x12\n" +
+	"\x04city\x18\f \x01(\tR\x04city\x12\x1f\n" +
+	"\vpostal_code\x18\r \x01(\tR\n" +
+	"postalCode\x12\x1a\n" +
+	"\blocation\x18\x0e \x01(\tR\blocation\x12\x1a\n" +
+	"\baltitude\x18\x0f \x01(\tR\baltitude\x12!\n" +
+	"\ftest_station\x18\x10 \x01(\bR\vtestStation\x126\n" +
+	"\x17last_communication_time\x18\x11 \x01(\tR\x15lastCommunicationTime\x12\x1b\n" +
+	"\tland_mark\x18\x12 \x01(\tR\blandMark\"\xab\x01\n" +
+	"\fShortStation\x12!\n" +
+	"\fstation_name\x18\x01 \x01(\tR\vstationName\x12\x18\n" +
+	"\aaddress\x18\x02 \x01(\tR\aaddress\x12'\n" +
+	"\x0favailable_docks\x18\x03 \x01(\x05R\x0eavailableDocks\x12\x1f\n" +
+	"\vtotal_docks\x18\x04 \x01(\x05R\n" +
+	"totalDocks\x12\x14\n" +
+	"\x05score\x18\x05 \x01(\x01R\x05score\"D\n" +
+	"\x10ShortStationList\x120\n" +
+	"\bstations\x18\x01 \x03(\v2\x14.nbc.v1.ShortStationR\bstations\"E\n" +
+	"\rBikesToReturn\x12\x1a\n" +
+	"\bdockable\x18\x01 \x01(\bR\bdockable\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\xc9\x03\n" +
+	"\rStationDetail\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x120\n" +
+	"\aaddress\x18\x03 \x01(\v2\x16.nbc.v1.StationAddressR\aaddress\x123\n" +
+	"\blocation\x18\x04 \x01(\v2\x17.nbc.v1.StationLocationR\blocation\x12-\n" +
+	"\x06status\x18\x05 \x01(\v2\x15.nbc.v1.StationStatusR\x06status\x12'\n" +
+	"\x0favailable_bikes\x18\x06 \x01(\x05R\x0eavailableBikes\x12'\n" +
+	"\x0favailable_docks\x18\a \x01(\x05R\x0eavailableDocks\x12\x1f\n" +
+	"\vtotal_docks\x18\b \x01(\x05R\n" +
+	"totalDocks\x12!\n" +
+	"\ftest_station\x18\t \x01(\bR\vtestStation\x126\n" +
+	"\x17last_communication_time\x18\n" +
+	" \x01(\tR\x15lastCommunicationTime\x12\x1a\n" +
+	"\bdistance\x18\v \x01(\x01R\bdistance\x12\x14\n" +
+	"\x05score\x18\f \x01(\x01R\x05score\"\x95\x01\n" +
+	"\x0eStationAddress\x12\x18\n" +
+	"\astreet1\x18\x01 \x01(\tR\astreet1\x12\x18\n" +
+	"\astreet2\x18\x02 \x01(\tR\astreet2\x12\x12\n" +
+	"\x04city\x18\x03 \x01(\tR\x04city\x12\x1f\n" +
+	"\vpostal_code\x18\x04 \x01(\tR\n" +
+	"postalCode\x12\x1a\n" +
+	"\blandmark\x18\x05 \x01(\tR\blandmark\"g\n" +
+	"\x0fStationLocation\x12\x1a\n" +
+	"\blatitude\x18\x01 \x01(\x01R\blatitude\x12\x1c\n" +
+	"\tlongitude\x18\x02 \x01(\x01R\tlongitude\x12\x1a\n" +
+	"\baltitude\x18\x03 \x01(\tR\baltitude\"V\n" +
+	"\rStationStatus\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x05R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value\x12\x1d\n" +
+	"\n" +
+	"in_service\x18\x03 \x01(\bR\tinService\"\xc7\x01\n" +
+	"\vStationPage\x121\n" +
+	"\bstations\x18\x01 \x03(\v2\x15.nbc.v1.StationDetailR\bstations\x12\x14\n" +
+	"\x05total\x18\x02 \x01(\x05R\x05total\x12\x12\n" +
+	"\x04page\x18\x03 \x01(\x05R\x04page\x12\x19\n" +
+	"\bper_page\x18\x04 \x01(\x05R\aperPage\x12\x1f\n" +
+	"\vtotal_pages\x18\x05 \x01(\x05R\n" +
+	"totalPages\x12\x1f\n" +
+	"\vnext_cursor\x18\x06 \x01(\tR\n" +
+	"nextCursorB\x1cZ\x1agithub.com/jsanc623/NBC/pbb\x06proto3"
+
+var (
+	file_stations_proto_rawDescOnce sync.Once
+	file_stations_proto_rawDescData []byte
+)
+
+func file_stations_proto_rawDescGZIP() []byte {
+	file_stations_proto_rawDescOnce.Do(func() {
+		file_stations_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_stations_proto_rawDesc), len(file_stations_proto_rawDesc)))
+	})
+	return file_stations_proto_rawDescData
+}
+
+var file_stations_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_stations_proto_goTypes = []any{
+	(*Station)(nil),          // 0: nbc.v1.Station
+	(*ShortStation)(nil),     // 1: nbc.v1.ShortStation
+	(*ShortStationList)(nil), // 2: nbc.v1.ShortStationList
+	(*BikesToReturn)(nil),    // 3: nbc.v1.BikesToReturn
+	(*StationDetail)(nil),    // 4: nbc.v1.StationDetail
+	(*StationAddress)(nil),   // 5: nbc.v1.StationAddress
+	(*StationLocation)(nil),  // 6: nbc.v1.StationLocation
+	(*StationStatus)(nil),    // 7: nbc.v1.StationStatus
+	(*StationPage)(nil),      // 8: nbc.v1.StationPage
+}
+var file_stations_proto_depIdxs = []int32{
+	1, // 0: nbc.v1.ShortStationList.stations:type_name -> nbc.v1.ShortStation
+	5, // 1: nbc.v1.StationDetail.address:type_name -> nbc.v1.StationAddress
+	6, // 2: nbc.v1.StationDetail.location:type_name -> nbc.v1.StationLocation
+	7, // 3: nbc.v1.StationDetail.status:type_name -> nbc.v1.StationStatus
+	4, // 4: nbc.v1.StationPage.stations:type_name -> nbc.v1.StationDetail
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_stations_proto_init() }
+func file_stations_proto_init() {
+	if File_stations_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_stations_proto_rawDesc), len(file_stations_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_stations_proto_goTypes,
+		DependencyIndexes: file_stations_proto_depIdxs,
+		MessageInfos:      file_stations_proto_msgTypes,
+	}.Build()
+	File_stations_proto = out.File
+	file_stations_proto_goTypes = nil
+	file_stations_proto_depIdxs = nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// problemContentType The media type of RFC 7807 error responses
+const problemContentType = "application/problem+json"
+
+// Problem types. Errors that need nothing beyond their status use about:blank
+const (
+	problemBlank               = "about:blank"
+	problemInvalidParameter    = "urn:nbc:problem:invalid-parameter"
+	problemStationNotFound     = "urn:nbc:problem:station-not-found"
+	problemUpstreamUnavailable = "urn:nbc:problem:upstream-unavailable"
+	problemUpstreamTimeout     = "urn:nbc:problem:upstream-timeout"
+	problemNotReady            = "urn:nbc:problem:not-ready"
+	problemCORSRejected        = "urn:nbc:problem:cors-rejected"
+	problemClientCertificate   = "urn:nbc:problem:client-certificate-required"
+)
+
+// Problem An RFC 7807 problem details error, the body of every error response
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// newProblem A problem of problemType; the title is the status text
+func newProblem(status int, problemType string, detail string) *Problem {
+	return &Problem{Type: problemType, Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Error Implements error
+func (P *Problem) Error() string {
+	return fmt.Sprintf("%d %s: %s", P.Status, P.Title, P.Detail)
+}
+
+// HandleProblem Writes problem as application/problem+json, filling in the request
+// path and ID. Server errors are also logged
+func HandleProblem(w http.ResponseWriter, r *http.Request, problem *Problem) {
+	problem.Instance = r.URL.Path
+	problem.RequestID = requestIDFromContext(r.Context())
+	if problem.Status >= http.StatusInternalServerError {
+		handleRequestError(r.Context(), "HandleProblem", problem)
+	}
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-App-Name", fmt.Sprintf("%s %s", App.Name, App.Version))
+	w.WriteHeader(problem.Status)
+	handleRequestError(r.Context(), "HandleProblem Encode", json.NewEncoder(w).Encode(problem))
+}
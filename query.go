@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stationFields Station's JSON field names and the index of the field each names
+var stationFields = func() map[string]int {
+	fields := make(map[string]int)
+	t := reflect.TypeOf(Station{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.SplitN(t.Field(i).Tag.Get("json"), ",", 2)[0]
+		fields[name] = i
+	}
+	return fields
+}()
+
+// fieldAliases Shorter names accepted for Station fields
+var fieldAliases = map[string]string{"name": "stationName"}
+
+// statusFilters The values of status= and the status key each keeps
+var statusFilters = map[string]int{"in-service": StatusOk, "not-in-service": StatusNotOk}
+
+// minimumFilters Query parameters that keep stations with at least that many of a field
+var minimumFilters = map[string]string{"minBikes": "availableBikes", "minDocks": "availableDocks"}
+
+// reservedParameters The query parameters of every listing which aren't filters
+var reservedParameters = map[string]bool{"sort": true, "fields": true, "format": true, "page": true, "perPage": true, "cursor": true}
+
+// stationQuery The filters, sort order and field projection asked for by a request
+type stationQuery struct {
+	filters []stationFilter
+	order   stationOrder
+	sorted  bool
+	fields  []string
+	format  string
+}
+
+// keep Reports whether station passes every filter
+func (Q *stationQuery) keep(station Station) bool {
+	for _, filter := range Q.filters {
+		if !filter(station) {
+			return false
+		}
+	}
+	return true
+}
+
+// stationField The index of the Station field called name, or an alias of it
+func stationField(name string) (int, bool) {
+	if alias, ok := fieldAliases[name]; ok {
+		name = alias
+	}
+	i, ok := stationFields[name]
+	return i, ok
+}
+
+// stationValue The value of Station field i; numbers are float64 and strings lowercase
+// so values can be used as sort keys
+func stationValue(station Station, i int) interface{} {
+	v := reflect.ValueOf(station).Field(i)
+	switch v.Kind() {
+	case reflect.Int:
+		return float64(v.Int())
+	case reflect.Float64:
+		return v.Float()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return strings.ToLower(v.String())
+}
+
+// parseStationQuery Parse the filters, sort=, fields= and format of r. presets are filters that
+// take precedence over the request's own, so that routes can be presets of the engine, and
+// params are the route's own query parameters. Any other parameter is rejected
+func parseStationQuery(r *http.Request, presets url.Values, params ...string) (*stationQuery, *Problem) {
+	query := r.URL.Query()
+	for _, name := range params {
+		query.Del(name)
+	}
+	for name, values := range presets {
+		query[name] = values
+	}
+
+	q, problem := parseStationValues(query)
+	if problem != nil {
+		return nil, problem
+	}
+
+	format, problem := negotiateFormat(r, listingEncoders)
+	if problem != nil {
+		return nil, problem
+	}
+	q.format = format
+	return q, nil
+}
+
+// parseStationValues Parse the filters, sort and fields of query. Any Station field can
+// be filtered on by its JSON name; status=, minBikes= and minDocks= are also accepted,
+// and anything else that isn't one of the reservedParameters is a problem
+func parseStationValues(query url.Values) (*stationQuery, *Problem) {
+	var q stationQuery
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !isFilter(name) && !reservedParameters[name] {
+			return nil, unknownParameter(name)
+		}
+		values := query[name]
+		filter, problem := parseFilter(name, values)
+		if problem != nil {
+			return nil, problem
+		}
+		if filter != nil {
+			q.filters = append(q.filters, filter)
+		}
+	}
+
+	if sortBy := query.Get("sort"); sortBy != "" {
+		var indexes []int
+		for _, name := range strings.Split(sortBy, ",") {
+			descending := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(strings.TrimPrefix(name, "-"), "+")
+			i, ok := stationField(name)
+			if !ok {
+				return nil, newProblem(http.StatusBadRequest, problemInvalidParameter,
+					fmt.Sprintf("Unknown sort field %q%s", name, suggest(name, stationFields)))
+			}
+			indexes = append(indexes, i)
+			q.order.descending = append(q.order.descending, descending)
+		}
+		q.order.key = func(station Station) []interface{} {
+			key := make([]interface{}, len(indexes))
+			for n, i := range indexes {
+				key[n] = stationValue(station, i)
+			}
+			return key
+		}
+		q.sorted = true
+	}
+
+	if fields := query.Get("fields"); fields != "" {
+		q.fields = strings.Split(fields, ",")
+	}
+	return &q, nil
+}
+
+// isFilter Reports whether query parameter name filters stations
+func isFilter(name string) bool {
+	_, minimum := minimumFilters[name]
+	_, field := stationFields[name]
+	return name == "status" || minimum || field
+}
+
+// unknownParameter The problem for a query parameter that is neither a filter nor one
+// of the reservedParameters, suggesting the closest that is
+func unknownParameter(name string) *Problem {
+	known := make(map[string]bool)
+	for field := range stationFields {
+		known[field] = true
+	}
+	for parameter := range minimumFilters {
+		known[parameter] = true
+	}
+	for parameter := range reservedParameters {
+		known[parameter] = true
+	}
+	known["status"] = true
+	return newProblem(http.StatusBadRequest, problemInvalidParameter,
+		fmt.Sprintf("Unknown query parameter %q%s", name, suggest(name, known)))
+}
+
+// parseFilter The filter for query parameter name, nil if name isn't a filter
+func parseFilter(name string, values []string) (stationFilter, *Problem) {
+	invalid := func(value string) *Problem {
+		return newProblem(http.StatusBadRequest, problemInvalidParameter, fmt.Sprintf("Invalid %s %q", name, value))
+	}
+
+	if name == "status" {
+		keys := make(map[int]bool)
+		for _, value := range values {
+			key, ok := statusFilters[value]
+			if !ok {
+				return nil, invalid(value)
+			}
+			keys[key] = true
+		}
+		return func(station Station) bool { return keys[station.StatusKey] }, nil
+	}
+
+	if field, ok := minimumFilters[name]; ok {
+		minimum, err := strconv.Atoi(values[0])
+		if err != nil || minimum < 0 {
+			return nil, invalid(values[0])
+		}
+		i := stationFields[field]
+		return func(station Station) bool {
+			return stationValue(station, i).(float64) >= float64(minimum)
+		}, nil
+	}
+
+	i, ok := stationFields[name]
+	if !ok {
+		return nil, nil
+	}
+
+	// Equality on any Station field, matching any of the values given
+	var wanted []interface{}
+	for _, value := range values {
+		var parsed interface{}
+		var err error
+		switch reflect.TypeOf(Station{}).Field(i).Type.Kind() {
+		case reflect.Int, reflect.Float64:
+			parsed, err = strconv.ParseFloat(value, 64)
+		case reflect.Bool:
+			parsed, err = strconv.ParseBool(value)
+		default:
+			parsed = strings.ToLower(value)
+		}
+		if err != nil {
+			return nil, invalid(value)
+		}
+		wanted = append(wanted, parsed)
+	}
+	return func(station Station) bool {
+		actual := stationValue(station, i)
+		for _, value := range wanted {
+			if actual == value {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// checkFields Validate fields against the JSON names of the station type rendered in
+// body, a listing that is either an array of stations or an object with a stations array
+func checkFields(body interface{}, fields []string) *Problem {
+	known := make(map[string]bool)
+	if items := listingItems(body); items.Kind() == reflect.Slice {
+		for _, field := range jsonFields(items.Type().Elem()) {
+			name, _ := jsonName(field)
+			known[name] = true
+		}
+	}
+	for _, field := range fields {
+		if !known[field] {
+			return newProblem(http.StatusBadRequest, problemInvalidParameter,
+				fmt.Sprintf("Unknown field %q%s", field, suggest(field, known)))
+		}
+	}
+	return nil
+}
+
+// project Keep only fields in each station of body, a rendered listing
+func project(body interface{}, fields []string) interface{} {
+	keep := make(map[string]bool)
+	for _, field := range fields {
+		keep[field] = true
+	}
+
+	b, _ := json.Marshal(body)
+	var generic interface{}
+	json.Unmarshal(b, &generic)
+
+	stations, _ := generic.([]interface{})
+	if object, ok := generic.(map[string]interface{}); ok {
+		stations, _ = object["stations"].([]interface{})
+	}
+	for _, station := range stations {
+		if object, ok := station.(map[string]interface{}); ok {
+			for name := range object {
+				if !keep[name] {
+					delete(object, name)
+				}
+			}
+		}
+	}
+	return generic
+}
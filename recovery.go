@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+const untimedKey contextKey = "untimed"
+
+// recoverPanic Middleware turning a panic further down the chain of route name into a
+// 500 problem, logging the stack with the request ID. A response that has already
+// started can't be replaced, so its connection is aborted instead
+func recoverPanic(next http.Handler, name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writer := &panicWriter{ResponseWriter: w}
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			httpPanics.WithLabelValues(name).Inc()
+			logRequestMessage(r.Context(), fmt.Sprintf("panic in %s: %v\n%s", name, recovered, debug.Stack()))
+			if writer.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+
+			// Drop what the chain set up for the response it didn't finish
+			for _, header := range []string{"Content-Encoding", "Content-Length", "ETag", "Last-Modified", "Cache-Control"} {
+				w.Header().Del(header)
+			}
+			HandleProblem(w, r, newProblem(http.StatusInternalServerError, problemBlank, "The request could not be completed"))
+		}()
+		next.ServeHTTP(writer, r)
+	})
+}
+
+// panicWriter Records whether the response has started
+type panicWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *panicWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *panicWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap The underlying writer, so http.ResponseController can flush through us
+func (w *panicWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// deadline Middleware giving the request's context a deadline, so upstream fetches
+// are cancelled once it passes. timeout is the route's own, 0 for SRV_REQUEST_TIMEOUT
+// or negative for none
+func deadline(next http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := timeout
+		if limit == 0 {
+			limit = currentConfig().Server.RequestTimeout
+		}
+		if limit <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.WithValue(r.Context(), untimedKey, r.Context()), limit)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// untimedContext The context of r without the deadline set by the deadline middleware,
+// for streams which run until the client goes away
+func untimedContext(r *http.Request) context.Context {
+	if ctx, ok := r.Context().Value(untimedKey).(context.Context); ok {
+		return ctx
+	}
+	return r.Context()
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sphireco/mantis"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Log levels, in increasing order of severity
+const (
+	levelDebug int32 = iota
+	levelInfo
+	levelError
+)
+
+var logLevels = map[string]int32{
+	"debug": levelDebug,
+	"info":  levelInfo,
+	"error": levelError,
+}
+
+// logLevel The current log level, accessed atomically
+var logLevel = levelInfo
+
+// liveConfig The configuration currently in effect, swapped atomically on reload
+var liveConfig atomic.Value
+
+// currentConfig The configuration in effect, or the defaults before setup has run
+func currentConfig() *Config {
+	if cfg, ok := liveConfig.Load().(*Config); ok {
+		return cfg
+	}
+	return defaultConfig()
+}
+
+// logEnabled True if messages at level should be written
+func logEnabled(level int32) bool {
+	return level >= atomic.LoadInt32(&logLevel)
+}
+
+// applyConfig Apply the settings that can change at runtime and make cfg current
+func applyConfig(cfg *Config) error {
+	atomic.StoreInt32(&logLevel, logLevels[cfg.Log.Level])
+	App.AccessLog.setSampleRate(cfg.Log.AccessSampleRate)
+
+	previous, ok := liveConfig.Load().(*Config)
+	if ok && previous.Server.MemCacheTime != cfg.Server.MemCacheTime {
+		if err := App.Router.setCacheTTL(cfg.Server.MemCacheTime); err != nil {
+			return err
+		}
+	}
+
+	liveConfig.Store(cfg)
+	return nil
+}
+
+// reloadConfig Re-read configuration with the original command line args. Live
+// settings are applied; changes to anything else are reported and kept at their
+// current value until restart. An invalid configuration is rejected whole
+func reloadConfig(args []string) error {
+	cfg, _, err := loadConfig(args)
+	if err != nil {
+		Logger.Write(fmt.Sprintf("Config reload rejected, keeping current configuration: %s", err))
+		return err
+	}
+
+	current := currentConfig()
+	currentSettings := current.settings()
+	var applied, restart []string
+
+	for i, s := range cfg.settings() {
+		was := currentSettings[i]
+		if s.String() == was.String() {
+			continue
+		}
+
+		change := fmt.Sprintf("%s %q -> %q", s.Key, was.String(), s.String())
+		if s.Secret {
+			change = s.Key + " changed"
+		}
+
+		if s.Live {
+			applied = append(applied, change)
+			continue
+		}
+		restart = append(restart, change)
+		s.value.Set(was.value)
+		cfg.sources[s.Key] = current.sources[s.Key]
+	}
+
+	if err := applyConfig(cfg); err != nil {
+		mantis.HandleError("reloadConfig:applyConfig", err)
+		return err
+	}
+
+	if len(applied) == 0 && len(restart) == 0 {
+		Logger.Write("Config reloaded, nothing changed")
+	}
+	if len(applied) > 0 {
+		Logger.Write("Config reloaded, applied: " + strings.Join(applied, ", "))
+	}
+	if len(restart) > 0 {
+		Logger.Write("Config reloaded, restart required for: " + strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+// watchConfig Reload whenever .env or the config file changes, until ctx is done.
+// Directories are watched rather than files so editors that replace files on save
+// are still picked up, and bursts of events are collapsed into one reload
+func watchConfig(ctx context.Context, args []string) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		mantis.HandleError("watchConfig:NewWatcher", err)
+		return
+	}
+	defer watcher.Close()
+
+	files := make(map[string]bool)
+	for _, file := range []string{dotEnvFile, currentConfig().file} {
+		if file == "" {
+			continue
+		}
+		path, err := filepath.Abs(file)
+		if err != nil {
+			mantis.HandleError("watchConfig:Abs", err)
+			continue
+		}
+		files[path] = true
+		mantis.HandleError("watchConfig:Add", watcher.Add(filepath.Dir(path)))
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-watcher.Events:
+			if path, err := filepath.Abs(event.Name); err == nil && files[path] {
+				pending = time.After(500 * time.Millisecond)
+			}
+		case err := <-watcher.Errors:
+			mantis.HandleError("watchConfig", err)
+		case <-pending:
+			pending = nil
+			reloadConfig(args)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/sphireco/mantis"
+	"net/http"
+)
+
+type contextKey string
+
+// requestIDHeader The header used to carry the request ID in and out of the service
+const requestIDHeader = "X-Request-Id"
+
+// sessionTokenHeader Set to the request ID on responses written by HandleResponse
+const sessionTokenHeader = "X-Session-Token"
+
+// maxRequestIDLength Incoming IDs longer than this are replaced with a generated one
+const maxRequestIDLength = 128
+
+const requestIDKey contextKey = "requestID"
+
+// requestID Middleware which accepts or generates a request ID, stores it in the
+// request context and stamps it onto the response
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = nextRequestID()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		next.ServeHTTP(&requestIDWriter{ResponseWriter: w, id: id}, r.WithContext(ctx))
+	})
+}
+
+// requestIDWriter Re-applies the request ID, and the session token if the response has
+// one, when headers are written, so responses replayed by http-cache don't carry the ID
+// of the request that populated the cache
+type requestIDWriter struct {
+	http.ResponseWriter
+	id          string
+	wroteHeader bool
+}
+
+// WriteHeader Force our request ID before sending the status line
+func (w *requestIDWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set(requestIDHeader, w.id)
+		if w.Header().Get(sessionTokenHeader) != "" {
+			w.Header().Set(sessionTokenHeader, w.id)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write Ensure headers are finalised before the first body write
+func (w *requestIDWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap The underlying writer, so http.ResponseController can flush through us
+func (w *requestIDWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// requestIDFromContext Returns the request ID stored in ctx, or an empty string
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// logRequestMessage Writes msg to the Logger, prefixed with the request ID
+func logRequestMessage(ctx context.Context, msg string) {
+	Logger.Write(fmt.Sprintf("[%s] %s", requestIDFromContext(ctx), msg))
+}
+
+// handleRequestError Passes err to mantis, tagging the entry with the request ID
+func handleRequestError(ctx context.Context, name string, err error) {
+	mantis.HandleError(fmt.Sprintf("[%s] %s", requestIDFromContext(ctx), name), err)
+}
+
+// validRequestID Only accept short, printable ASCII IDs from clients
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// nextRequestID Generates a random 128 bit ID, hex encoded
+func nextRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		mantis.HandleError("nextRequestID", err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
-	"github.com/victorspringer/http-cache"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
 	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type handler func(http.ResponseWriter, *http.Request)
@@ -13,73 +19,359 @@ type handler func(http.ResponseWriter, *http.Request)
 type Router struct {
 	Routes      []Route `json:"routes"`
 	router      *mux.Router
-	httpCache   *cache.Client
+	tables      map[string]*routeTable
+	httpCache   atomic.Value
 	middlewares map[string]func(http.Handler) http.Handler
 }
 
-// Route Define a route
+// Route Define a route. CacheTTL is empty to use the shared http-cache TTL, "0" to
+// never cache, or a duration such as "30s" for a route specific cache. Routes with
+// a Version are served under /<version>; URI includes that prefix once loaded. Listeners
+// names the SRV_LISTENERS serving the route, which otherwise goes to the default listener.
+// Timeout bounds the request like CacheTTL: empty for SRV_REQUEST_TIMEOUT, "0" for none
 type Route struct {
-	Name       string   `json:"name"`
-	Method     string   `json:"method"`
-	URI        string   `json:"uri"`
-	Middleware []string `json:"middleware"`
+	Name       string      `json:"name" yaml:"name"`
+	Method     string      `json:"method" yaml:"method"`
+	URI        string      `json:"uri" yaml:"uri"`
+	Version    string      `json:"version,omitempty" yaml:"version"`
+	Deprecated bool        `json:"deprecated,omitempty" yaml:"-"`
+	Summary    string      `json:"summary,omitempty" yaml:"-"`
+	Parameters []Parameter `json:"parameters,omitempty" yaml:"-"`
+	Handler    string      `json:"handler" yaml:"handler"`
+	Middleware []string    `json:"middleware" yaml:"middleware"`
+	CacheTTL   string      `json:"cache_ttl,omitempty" yaml:"cache_ttl"`
+	Listeners  []string    `json:"listeners,omitempty" yaml:"listeners"`
+	Timeout    string      `json:"timeout,omitempty" yaml:"timeout"`
 	handler    func(http.ResponseWriter, *http.Request)
+	cacheTTL   time.Duration
+	timeout    time.Duration
+	request    interface{}
+	responses  map[int]interface{}
+	encoders   []formatEncoder
 }
 
-// newRoutes Define our custom routes here
-func (R *Router) newRoutes() {
-	R.new("GetStations", "GET", "/stations", GetStations, []string{})
-	R.new("GetStationsInService", "GET", "/stations/in-service", GetStationsInService, []string{})
-	R.new("GetStationsNotInService", "GET", "/stations/not-in-service", GetStationsNotInService, []string{})
-	R.new("GetStationsMatchingString", "GET", "/stations/{search}", GetStationsMatchingString, []string{})
-	R.new("GetIsBikeDockable", "GET", "/dockable/{stationId}/{bikesToReturn}", GetIsBikeDockable, []string{})
+// Parameter A path or query parameter accepted by a route
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
 }
 
-// Load Create a new router and attach our default and custom routes
-func (R *Router) Load() {
-	R.router = mux.NewRouter().StrictSlash(false)
+// routeParameters The declared parameters, plus a string parameter for each {name}
+// or {name:pattern} variable in the mux URI template that isn't declared
+func routeParameters(uri string, declared []Parameter) []Parameter {
+	parameters := append([]Parameter{}, declared...)
+	for _, segment := range strings.Split(uri, "/") {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+
+		name := strings.SplitN(strings.Trim(segment, "{}"), ":", 2)[0]
+		found := false
+		for _, parameter := range declared {
+			found = found || (parameter.In == "path" && parameter.Name == name)
+		}
+		if !found {
+			parameters = append(parameters, Parameter{Name: name, In: "path", Type: "string", Required: true})
+		}
+	}
+	return parameters
+}
+
+// handlerSpec A handler and the metadata used to document routes that call it.
+// Handlers with encoders write their responses in any of those formats, negotiated
+// from the Accept header or ?format=
+type handlerSpec struct {
+	handler    handler
+	summary    string
+	parameters []Parameter
+	request    interface{}
+	responses  map[int]interface{}
+	encoders   []formatEncoder
+}
+
+// pagingParameters Query parameters accepted by paged, limited listings
+var pagingParameters = []Parameter{
+	{Name: "page", In: "query", Type: "integer", Description: "Page number, starting at 1"},
+	{Name: "perPage", In: "query", Type: "integer", Description: "Items per page, default 20, at most SRV_MAX_PER_PAGE"},
+	{Name: "cursor", In: "query", Type: "string", Description: "Resume after the page that returned this nextCursor"},
+}
+
+// listingParameters Query parameters accepted by station listings: paging, filters
+// on any Station field by its JSON name (the common ones listed), sort, fields and format
+var listingParameters = append(append([]Parameter{}, pagingParameters...),
+	Parameter{Name: "status", In: "query", Type: "string", Description: "in-service or not-in-service"},
+	Parameter{Name: "minBikes", In: "query", Type: "integer", Description: "At least this many available bikes"},
+	Parameter{Name: "minDocks", In: "query", Type: "integer", Description: "At least this many available docks"},
+	Parameter{Name: "city", In: "query", Type: "string", Description: "Case-insensitive city"},
+	Parameter{Name: "postalCode", In: "query", Type: "string", Description: "Postal code"},
+	Parameter{Name: "testStation", In: "query", Type: "boolean", Description: "Test stations only, or none"},
+	Parameter{Name: "sort", In: "query", Type: "string", Description: "Comma separated Station fields, - for descending, e.g. availableDocks,-availableBikes,name"},
+	Parameter{Name: "fields", In: "query", Type: "string", Description: "Comma separated fields to return for each station"},
+	Parameter{Name: "format", In: "query", Type: "string", Description: "json, csv, geojson, xml, protobuf or msgpack, instead of the Accept header"},
+)
+
+// listingResponses The responses of a paged station listing whose pages are body
+func listingResponses(body interface{}) map[int]interface{} {
+	return map[int]interface{}{http.StatusOK: body, http.StatusBadRequest: Problem{}, http.StatusBadGateway: Problem{}}
+}
+
+// handlerRegistry Every handler a route file can refer to, by name
+var handlerRegistry = map[string]handlerSpec{
+	"HomeServer": {handler: HomeServer, summary: "Basic status",
+		responses: map[int]interface{}{http.StatusOK: ""}},
+	"GetStatus": {handler: GetStatus, summary: "Extended application status",
+		responses: map[int]interface{}{http.StatusOK: Status{}}},
+	"GetHealthz": {handler: GetHealthz, summary: "Liveness probe",
+		responses: map[int]interface{}{http.StatusOK: ""}},
+	"GetReadyz": {handler: GetReadyz, summary: "Readiness probe, fails until the feed has loaded",
+		responses: map[int]interface{}{http.StatusOK: "", http.StatusServiceUnavailable: Problem{}}},
+	"Teapot": {handler: Teapot, summary: "Are you a teapot?",
+		responses: map[int]interface{}{http.StatusTeapot: Problem{}}},
+	"GetRoutes": {handler: GetRoutes, summary: "All registered routes",
+		responses: map[int]interface{}{http.StatusOK: []Route{}}},
+	"GetMetrics": {handler: GetMetrics, summary: "Prometheus metrics in the text exposition format",
+		responses: map[int]interface{}{http.StatusOK: ""}},
+	"GetOpenAPI": {handler: GetOpenAPI, summary: "This OpenAPI 3 specification",
+		responses: map[int]interface{}{http.StatusOK: map[string]interface{}{}}},
+	"GetDocs": {handler: GetDocs, summary: "Interactive API documentation",
+		responses: map[int]interface{}{http.StatusOK: ""}},
+	"PostGraphQL": {handler: PostGraphQL, summary: "GraphQL queries over the stations, and subscriptions streamed as server-sent events",
+		request:   graphQLRequest{},
+		responses: map[int]interface{}{http.StatusOK: map[string]interface{}{}, http.StatusBadRequest: Problem{}}},
+
+	"GetStations": {handler: GetStations, encoders: listingEncoders, summary: "All stations", parameters: listingParameters,
+		responses: listingResponses([]ShortStation{})},
+	"GetStationsInService": {handler: GetStationsInService, encoders: listingEncoders, summary: "Stations that are in service", parameters: listingParameters,
+		responses: listingResponses([]ShortStation{})},
+	"GetStationsNotInService": {handler: GetStationsNotInService, encoders: listingEncoders, summary: "Stations that are not in service", parameters: listingParameters,
+		responses: listingResponses([]ShortStation{})},
+	"GetStationsMatchingString": {handler: GetStationsMatchingString, encoders: listingEncoders, summary: "Typo-tolerant, ranked search of station names and addresses", parameters: listingParameters,
+		responses: listingResponses([]ShortStation{})},
+	"GetIsBikeDockable": {handler: GetIsBikeDockable, encoders: documentEncoders, summary: "Whether a station has enough docks to return bikes",
+		parameters: []Parameter{
+			{Name: "stationId", In: "path", Type: "integer", Required: true},
+			{Name: "bikesToReturn", In: "path", Type: "integer", Required: true},
+		},
+		responses: map[int]interface{}{http.StatusOK: BikesToReturn{}, http.StatusBadRequest: Problem{},
+			http.StatusNotFound: Problem{}, http.StatusBadGateway: Problem{}}},
+
+	"GetStationsV2": {handler: GetStationsV2, encoders: listingEncoders, summary: "All stations", parameters: listingParameters,
+		responses: listingResponses(StationPage{})},
+	"GetStationsInServiceV2": {handler: GetStationsInServiceV2, encoders: listingEncoders, summary: "Stations that are in service", parameters: listingParameters,
+		responses: listingResponses(StationPage{})},
+	"GetStationsNotInServiceV2": {handler: GetStationsNotInServiceV2, encoders: listingEncoders, summary: "Stations that are not in service", parameters: listingParameters,
+		responses: listingResponses(StationPage{})},
+	"GetStationsNearV2": {handler: GetStationsNearV2, encoders: listingEncoders, summary: "Stations within a radius of a point, nearest first",
+		parameters: append([]Parameter{
+			{Name: "lat", In: "query", Type: "number", Description: "Latitude", Required: true},
+			{Name: "lon", In: "query", Type: "number", Description: "Longitude", Required: true},
+			{Name: "radius", In: "query", Type: "number", Description: "Radius in meters, default 500"},
+		}, listingParameters...),
+		responses: listingResponses(StationPage{})},
+	"GetStationSuggestions": {handler: GetStationSuggestions, summary: "Autocomplete station names and addresses",
+		parameters: []Parameter{
+			{Name: "q", In: "query", Type: "string", Description: "What has been typed so far", Required: true},
+			{Name: "limit", In: "query", Type: "integer", Description: "At most this many suggestions, default 10, at most 50"},
+		},
+		responses: map[int]interface{}{http.StatusOK: []Suggestion{}, http.StatusBadRequest: Problem{},
+			http.StatusBadGateway: Problem{}}},
+	"GetStationsMatchingStringV2": {handler: GetStationsMatchingStringV2, encoders: listingEncoders, summary: "Typo-tolerant, ranked search of station names and addresses", parameters: listingParameters,
+		responses: listingResponses(StationPage{})},
+}
+
+// apiVersions The API versions routes can be mounted under
+var apiVersions = []string{"v1", "v2"}
+
+// legacyVersion Unversioned paths are deprecated aliases for this version
+const legacyVersion = "v1"
+
+// Load Create a new router and attach the routes defined in the routes file
+func (R *Router) Load() error {
+	listeners, err := currentConfig().Server.listeners()
+	if err != nil {
+		return err
+	}
+	R.tables = make(map[string]*routeTable)
+	for _, listener := range listeners {
+		R.tables[listener.Name] = newRouteTable()
+	}
+	R.router = R.tables[defaultListener].router
 	R.startCache()
 	R.registerMiddleWare()
 
-	R.router.NotFoundHandler = http.HandlerFunc(NotFoundServer)
-	R.new("HomeServer", "GET", "/", HomeServer, []string{})
-	R.new("Status", "GET", "/status", GetStatus, []string{})
-	R.new("Teapot", "GET", "/teapot", Teapot, []string{})
-	R.new("GetRoutes", "GET", "/routes", GetRoutes, []string{})
+	routes, err := R.loadRoutes(currentConfig().Server.RoutesFile)
+	if err != nil {
+		return err
+	}
+	R.Routes = routes
 
-	R.newRoutes()
+	// Keep the original unversioned paths working as deprecated aliases
+	for _, route := range routes {
+		if route.Version == legacyVersion {
+			alias := route
+			alias.Name = route.Name + "Deprecated"
+			alias.URI = strings.TrimPrefix(route.URI, "/"+legacyVersion)
+			alias.Version = ""
+			alias.Deprecated = true
+			R.Routes = append(R.Routes, alias)
+		}
+	}
 
 	for _, route := range R.Routes {
-		Logger.Write(fmt.Sprintf("Activating %s (%s %s)", route.Name, route.Method, route.URI))
-		R.addRoute(route)
+		Logger.Write(fmt.Sprintf("Activating %s (%s %s) on %s", route.Name, route.Method, route.URI, strings.Join(R.servedOn(route), ", ")))
+		if err := R.addRoute(route); err != nil {
+			return err
+		}
 	}
+	R.addPreflights()
+	return nil
 }
 
-// new Append a new route to our routes
-func (R *Router) new(name string, method string, uri string, handler handler, middleware []string) {
-	Logger.Write(fmt.Sprintf("Registering %s (%s %s)", name, method, uri))
-	R.Routes = append(R.Routes, Route{
-		Name:       name,
-		Method:     method,
-		URI:        uri,
-		handler:    handler,
-		Middleware: middleware,
-	})
-}
+// loadRoutes Read routes from a JSON or YAML file, resolving handlers and checking
+// middleware. Every problem in the file is reported together
+func (R *Router) loadRoutes(path string) ([]Route, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 
-// addRoute Add a route to our router
-func (R *Router) addRoute(route Route) {
-	// Apply our two forced middlewares
-	handler := logRequest(http.HandlerFunc(route.handler), route.Name)
-	handler = basicHeaders(handler)
+	var routes []Route
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(contents, &routes)
+	default:
+		err = json.Unmarshal(contents, &routes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	var problems ConfigErrors
+	names := make(map[string]bool)
+	for i := range routes {
+		route := &routes[i]
+		Logger.Write(fmt.Sprintf("Registering %s (%s %s)", route.Name, route.Method, route.URI))
+
+		if route.Name == "" {
+			problems = append(problems, fmt.Sprintf("%s: route %d has no name", path, i+1))
+		} else if names[route.Name] {
+			problems = append(problems, fmt.Sprintf("%s: route %q is defined more than once", path, route.Name))
+		}
+		names[route.Name] = true
+
+		route.Method = strings.ToUpper(route.Method)
+		if route.Method != "GET" && route.Method != "HEAD" && route.Method != "POST" {
+			problems = append(problems, fmt.Sprintf("%s: route %q has unsupported method %q", path, route.Name, route.Method))
+		}
+		if !strings.HasPrefix(route.URI, "/") {
+			problems = append(problems, fmt.Sprintf("%s: route %q has invalid uri %q", path, route.Name, route.URI))
+		}
+		if route.Version != "" {
+			if !containsString(apiVersions, route.Version) {
+				problems = append(problems, fmt.Sprintf("%s: route %q has unknown version %q", path, route.Name, route.Version))
+			}
+			route.URI = "/" + route.Version + route.URI
+		}
+
+		spec, ok := handlerRegistry[route.Handler]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: route %q has unknown handler %q", path, route.Name, route.Handler))
+		}
+		route.handler = spec.handler
+		route.Summary = spec.summary
+		route.Parameters = routeParameters(route.URI, spec.parameters)
+		route.request = spec.request
+		route.responses = spec.responses
+		route.encoders = spec.encoders
+
+		for _, name := range route.Listeners {
+			if !listenerName.MatchString(name) {
+				problems = append(problems, fmt.Sprintf("%s: route %q has invalid listener %q", path, route.Name, name))
+			}
+		}
 
-	// Apply all of our other middlewares specific to this route
-	if len(route.Middleware) > 0 {
 		for _, middleware := range route.Middleware {
-			handler = R.middlewares[middleware](handler)
+			if R.middlewares[middleware] == nil {
+				problems = append(problems, fmt.Sprintf("%s: route %q has unknown middleware %q", path, route.Name, middleware))
+			}
+		}
+
+		// A zero TTL is stored as -1 so that 0 can mean "use the shared cache"
+		if route.CacheTTL != "" {
+			ttl, err := time.ParseDuration(route.CacheTTL)
+			if err != nil || ttl < 0 {
+				problems = append(problems, fmt.Sprintf("%s: route %q has invalid cache_ttl %q", path, route.Name, route.CacheTTL))
+			}
+			route.cacheTTL = ttl
+			if ttl == 0 {
+				route.cacheTTL = -1
+			}
+		}
+		if route.Timeout != "" {
+			timeout, err := time.ParseDuration(route.Timeout)
+			if err != nil || timeout < 0 {
+				problems = append(problems, fmt.Sprintf("%s: route %q has invalid timeout %q", path, route.Name, route.Timeout))
+			}
+			route.timeout = timeout
+			if timeout == 0 {
+				route.timeout = -1
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return routes, nil
+}
+
+// addRoute Add a route to our router. Every layer of the chain is wrapped in its
+// own span so traces show where request time is spent
+func (R *Router) addRoute(route Route) error {
+	// Apply our forced middleware
+	handler := cacheMiss(traceSpan(http.HandlerFunc(route.handler), "handler"))
+
+	// Logging and the request ID wrap the cache so that cached responses are
+	// logged and still get a fresh ID
+	switch {
+	case route.cacheTTL == 0:
+		handler = traceSpan(cacheLookup(R.cacheMiddleware(handler)), "http-cache")
+	case route.cacheTTL > 0:
+		client, err := newCacheClient(route.cacheTTL)
+		if err != nil {
+			return err
 		}
+		handler = traceSpan(cacheLookup(client.Middleware(handler)), "http-cache")
 	}
 
-	handler = R.httpCache.Middleware(handler)
-	R.router.Methods(route.Method).Path(route.URI).Name(route.Name).Handler(handler)
+	// Apply all of our other middlewares specific to this route. They wrap the cache
+	// so that checks such as adminOnly also apply to cached responses
+	for _, middleware := range route.Middleware {
+		handler = traceSpan(R.middlewares[middleware](handler), middleware)
+	}
+	if len(route.encoders) > 0 {
+		handler = traceSpan(negotiate(handler, route.encoders), "negotiate")
+	}
+	// Validators and encodings are applied to cached and fresh responses alike
+	handler = traceSpan(conditional(handler), "conditional")
+	handler = traceSpan(compress(handler), "compress")
+	handler = traceSpan(cors(handler), "cors")
+	// Panics become a 500 which is logged, and the deadline covers cache lookups too
+	handler = traceSpan(recoverPanic(handler, route.Name), "recoverPanic")
+	handler = deadline(handler, route.timeout)
+	handler = traceSpan(logRequest(handler, route.Name), "logRequest")
+	if route.Deprecated {
+		handler = deprecated(handler, "/"+legacyVersion, currentConfig().Server.UnversionedSunset)
+	}
+	handler = requestID(handler)
+	handler = traceRequest(handler, route.Name)
+
+	for _, name := range R.servedOn(route) {
+		router, path := R.tables[name].routerFor(route)
+		router.Methods(route.Method).Path(path).Name(route.Name).Handler(handler)
+	}
+	return nil
 }
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jsanc623/NBC/model"
+	"github.com/sphireco/mantis"
+	"hash/fnv"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Suggestion An autocomplete suggestion; shared with API clients through the model package
+type Suggestion = model.Suggestion
+
+// abbreviations Street words and their abbreviations, indexed and searched in full
+var abbreviations = map[string]string{
+	"st": "street", "str": "street", "ave": "avenue", "av": "avenue", "pl": "place",
+	"blvd": "boulevard", "rd": "road", "dr": "drive", "sq": "square", "pkwy": "parkway",
+	"ln": "lane", "ct": "court", "hwy": "highway", "expy": "expressway", "ter": "terrace",
+	"plz": "plaza", "e": "east", "w": "west", "n": "north", "s": "south", "bway": "broadway",
+	"bdwy": "broadway", "hts": "heights", "pk": "park",
+}
+
+// ordinals Spelt out ordinal street numbers
+var ordinals = map[string]string{
+	"first": "1", "second": "2", "third": "3", "fourth": "4", "fifth": "5", "sixth": "6",
+	"seventh": "7", "eighth": "8", "ninth": "9", "tenth": "10", "eleventh": "11", "twelfth": "12",
+}
+
+// stopWords Tokens that carry no meaning in a station name; & is read as and
+var stopWords = map[string]bool{"and": true, "the": true, "of": true, "at": true}
+
+// tokenize Split text into normalised search terms: lowercase, abbreviations and
+// ordinals expanded, "41st" read as "41" and stop words dropped
+func tokenize(text string) []string {
+	text = strings.ReplaceAll(strings.ToLower(text), "&", " and ")
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if full, ok := abbreviations[word]; ok {
+			word = full
+		}
+		if number, ok := ordinals[word]; ok {
+			word = number
+		}
+		if n := len(word); n > 2 && unicode.IsDigit(rune(word[0])) {
+			switch word[n-2:] {
+			case "st", "nd", "rd", "th":
+				if _, err := strconv.Atoi(word[:n-2]); err == nil {
+					word = word[:n-2]
+				}
+			}
+		}
+		if !stopWords[word] {
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// Weights of matches by where the term is and how closely it matched
+const (
+	nameWeight    = 1.0
+	addressWeight = 0.8
+	exactMatch    = 1.0
+	prefixMatch   = 0.8
+	fuzzyMatch    = 0.6
+)
+
+// searchIndex An inverted index over the names and addresses of one snapshot
+type searchIndex struct {
+	version  uint64
+	stations map[int]Station
+	// postings term -> station ID -> field weight
+	postings map[string]map[int]float64
+	terms    []string
+}
+
+// currentIndex The index of the most recent snapshot
+var currentIndex struct {
+	sync.Mutex
+	index *searchIndex
+}
+
+// snapshotVersion Identifies a snapshot by the searchable content of its stations
+func snapshotVersion(stations []Station) uint64 {
+	h := fnv.New64a()
+	for _, station := range stations {
+		fmt.Fprintf(h, "%d\x00%s\x00%s\x00%s\x00", station.Id, station.StationName, station.Address1, station.Address2)
+	}
+	return h.Sum64()
+}
+
+// indexFor The index for stations, built once per snapshot
+func indexFor(stations []Station) *searchIndex {
+	version := snapshotVersion(stations)
+
+	currentIndex.Lock()
+	defer currentIndex.Unlock()
+	if currentIndex.index == nil || currentIndex.index.version != version {
+		currentIndex.index = buildIndex(stations, version)
+	}
+	return currentIndex.index
+}
+
+// buildIndex Index the name and address terms of stations
+func buildIndex(stations []Station, version uint64) *searchIndex {
+	index := &searchIndex{
+		version:  version,
+		stations: make(map[int]Station, len(stations)),
+		postings: make(map[string]map[int]float64),
+	}
+
+	add := func(id int, text string, weight float64) {
+		for _, term := range tokenize(text) {
+			if index.postings[term] == nil {
+				index.postings[term] = make(map[int]float64)
+				index.terms = append(index.terms, term)
+			}
+			if weight > index.postings[term][id] {
+				index.postings[term][id] = weight
+			}
+		}
+	}
+	for _, station := range stations {
+		index.stations[station.Id] = station
+		add(station.Id, station.StationName, nameWeight)
+		add(station.Id, station.Address1+" "+station.Address2, addressWeight)
+	}
+	sort.Strings(index.terms)
+	return index
+}
+
+// maxEdits The typos tolerated in a term of n letters
+func maxEdits(n int) int {
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	}
+	return 0
+}
+
+// matches The indexed terms close to term and how well each matches. Prefixes match
+// terms of three letters or more, or any length when prefix is set
+func (I *searchIndex) matches(term string, prefix bool) map[string]float64 {
+	found := make(map[string]float64)
+	if _, ok := I.postings[term]; ok {
+		found[term] = exactMatch
+	}
+
+	if prefix || len(term) >= 3 {
+		start := sort.SearchStrings(I.terms, term)
+		for i := start; i < len(I.terms) && strings.HasPrefix(I.terms[i], term); i++ {
+			if found[I.terms[i]] == 0 {
+				found[I.terms[i]] = prefixMatch
+			}
+		}
+	}
+
+	if edits := maxEdits(len(term)); edits > 0 {
+		for _, candidate := range I.terms {
+			if found[candidate] > 0 || absInt(len(candidate)-len(term)) > edits {
+				continue
+			}
+			if d := levenshtein(term, candidate); d <= edits {
+				found[candidate] = fuzzyMatch * (1 - float64(d-1)/float64(edits+1))
+			}
+		}
+	}
+	return found
+}
+
+// search Score every station matching all terms of query, from 0 to 1. With prefix,
+// the last term is matched as the start of a word, for autocomplete
+func (I *searchIndex) search(query string, prefix bool) map[int]float64 {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return map[int]float64{}
+	}
+
+	var scores map[int]float64
+	for n, term := range terms {
+		best := make(map[int]float64)
+		for candidate, match := range I.matches(term, prefix && n == len(terms)-1) {
+			for id, weight := range I.postings[candidate] {
+				if score := match * weight; score > best[id] {
+					best[id] = score
+				}
+			}
+		}
+
+		// Every term has to match
+		if scores == nil {
+			scores = best
+			continue
+		}
+		for id := range scores {
+			if best[id] == 0 {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += best[id]
+		}
+	}
+
+	for id := range scores {
+		scores[id] = math.Round(scores[id]/float64(len(terms))*1000) / 1000
+	}
+	return scores
+}
+
+// absInt The absolute value of n
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// searchScores The scores of stations matching the /stations/:search string, nil
+// if it is empty
+func searchScores(r *http.Request, stations []Station) map[int]float64 {
+	search := strings.TrimSpace(mantis.GetUrlParameter(r, "search"))
+	if search == "" {
+		return nil
+	}
+	return indexFor(stations).search(search, false)
+}
+
+// GetStationSuggestions Autocompletes ?q against station names and addresses,
+// returning up to ?limit (default 10, at most 50) suggestions, best first
+func GetStationSuggestions(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		HandleProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "Missing q"))
+		return
+	}
+	limit := 10
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > 50 {
+			HandleProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "limit must be between 1 and 50"))
+			return
+		}
+	}
+
+	var stations Stations
+	stationList, err := stations.getJSON(r.Context())
+	if err != nil {
+		HandleProblem(w, r, upstreamProblem(r.Context()))
+		return
+	}
+
+	index := indexFor(stationList)
+	var suggestions = make([]Suggestion, 0)
+	for id, score := range index.search(q, true) {
+		suggestions = append(suggestions, Suggestion{ID: id, Name: index.stations[id].StationName, Score: score})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	setSnapshotHeaders(w, r, "")
+	HandleResponse(w, r, suggestions, http.StatusOK)
+}
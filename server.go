@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/sphireco/mantis"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// listenFDEnv Set on a child process started by SIGUSR2; holds the inherited listener
+// fds, comma separated in the order the listeners are configured
+const listenFDEnv = "NBC_LISTEN_FD"
+
+// background Cancelled when the server starts shutting down; background workers
+// and long-lived streams should stop when it is done
+var background, stopBackground = context.WithCancel(context.Background())
+
+// serve Run each of servers on its listener in specs, over TLS if it has a TLSConfig,
+// and App.GRPC on the grpc listener which follows them, until SIGINT or SIGTERM, then
+// drain in-flight requests. On SIGUSR2
+// the listeners are handed to a freshly started copy of the binary before draining,
+// and SIGHUP reloads configuration
+func serve(servers []*http.Server, specs []ListenerConfig) error {
+	listeners, err := listen(specs)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, len(servers))
+	for i, spec := range specs {
+		Logger.Write(fmt.Sprintf("Serving %s listener on %s %s", spec.Name, spec.Network, spec.Address))
+		if spec.Name == grpcListener {
+			go func(listener net.Listener) {
+				mantis.HandleError("serveGRPC", serveGRPC(App.GRPC, App.GRPCHealth, listener))
+			}(listeners[i])
+			continue
+		}
+		go func(srv *http.Server, listener net.Listener) {
+			// The certificates come from srv.TLSConfig
+			if srv.TLSConfig != nil {
+				errs <- srv.ServeTLS(listener, "", "")
+				return
+			}
+			errs <- srv.Serve(listener)
+		}(servers[i], listeners[i])
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR2, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	for {
+		select {
+		case err := <-errs:
+			return err
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				Logger.Write("Received SIGHUP, reloading configuration")
+				reloadConfig(os.Args[1:])
+				continue
+			}
+
+			if sig == syscall.SIGUSR2 {
+				pid, err := handoff(listeners)
+				if err != nil {
+					mantis.HandleError("serve:handoff", err)
+					continue
+				}
+				Logger.Write(fmt.Sprintf("Handed listeners to pid %d", pid))
+			}
+
+			Logger.Write(fmt.Sprintf("Received %s, shutting down", sig))
+			return shutdown(servers...)
+		}
+	}
+}
+
+// listen Reuse the listeners inherited from a parent process, or open new ones for
+// specs. A unix socket left behind by a crashed process is replaced
+func listen(specs []ListenerConfig) ([]net.Listener, error) {
+	fds := os.Getenv(listenFDEnv)
+	if fds == "" {
+		listeners := make([]net.Listener, 0, len(specs))
+		for _, spec := range specs {
+			if spec.Network == "unix" {
+				removeStaleSocket(spec.Address)
+			}
+			listener, err := net.Listen(spec.Network, spec.Address)
+			if err != nil {
+				closeListeners(listeners)
+				return nil, err
+			}
+			listeners = append(listeners, listener)
+		}
+		return listeners, nil
+	}
+
+	inherited := strings.Split(fds, ",")
+	if len(inherited) != len(specs) {
+		return nil, fmt.Errorf("%s has %d listeners but %d are configured", listenFDEnv, len(inherited), len(specs))
+	}
+	listeners := make([]net.Listener, 0, len(specs))
+	for _, fd := range inherited {
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("invalid %s %q: %s", listenFDEnv, fds, err)
+		}
+		file := os.NewFile(uintptr(n), "listener")
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		Logger.Write(fmt.Sprintf("Inherited listener on fd %d", n))
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// closeListeners Close listeners opened before one of the others failed
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// handoff Start a new copy of this binary which inherits the listeners
+func handoff(listeners []net.Listener) (int, error) {
+	files := make([]*os.File, 0, len(listeners))
+	fds := make([]string, 0, len(listeners))
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, listener := range listeners {
+		var file *os.File
+		var err error
+		switch l := listener.(type) {
+		case *net.TCPListener:
+			file, err = l.File()
+		case *net.UnixListener:
+			// The child serves the socket from now on, so closing ours mustn't remove it
+			l.SetUnlinkOnClose(false)
+			file, err = l.File()
+		default:
+			err = fmt.Errorf("cannot hand off %T", listener)
+		}
+		if err != nil {
+			return 0, err
+		}
+		// ExtraFiles start at fd 3 in the child
+		fds = append(fds, strconv.Itoa(3+len(files)))
+		files = append(files, file)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(os.Environ(), listenFDEnv+"="+strings.Join(fds, ","))
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	return cmd.Process.Pid, nil
+}
+
+// shutdown Stop accepting connections, wait up to App.Server.ShutdownTimeout for
+// in-flight requests on every server and gRPC calls, then flush traces, stop background
+// work and release resources
+func shutdown(servers ...*http.Server) error {
+	stopBackground()
+
+	ctx, cancel := context.WithTimeout(context.Background(), App.Server.ShutdownTimeout)
+	defer cancel()
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func(i int, srv *http.Server) {
+			defer wg.Done()
+			errs[i] = srv.Shutdown(ctx)
+		}(i, srv)
+	}
+	wg.Wait()
+	err := errors.Join(errs...)
+	if App.GRPC != nil {
+		stopGRPC(ctx, App.GRPC, App.GRPCHealth)
+	}
+	// With everything drained, the spans of the last requests can be exported
+	if App.ShutdownTracing != nil {
+		mantis.HandleError("shutdown:Tracing", App.ShutdownTracing(ctx))
+	}
+
+	if App.Redis != nil {
+		mantis.HandleError("shutdown:Redis", App.Redis.Close())
+	}
+	Logger.Write("Shutdown complete")
+	mantis.HandleError("shutdown:AccessLog", App.AccessLog.Close())
+	return err
+}
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/jsanc623/NBC/model"
 	"github.com/sphireco/mantis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Stations struct {
@@ -16,124 +26,246 @@ type Stations struct {
 	StationBeanList []Station `json:"stationBeanList"`
 }
 
-type Station struct {
-	Id                    int     `json:"id"`
-	StationName           string  `json:"stationName"`
-	AvailableDocks        int     `json:"availableDocks"`
-	TotalDocks            int     `json:"totalDocks"`
-	Latitude              float64 `json:"latitude"`
-	Longitude             float64 `json:"longitude"`
-	StatusValue           string  `json:"statusValue"`
-	StatusKey             int     `json:"statusKey"`
-	AvailableBikes        int     `json:"availableBikes"`
-	Address1              string  `json:"stAddress1"`
-	Address2              string  `json:"stAddress2"`
-	City                  string  `json:"city"`
-	PostalCode            string  `json:"postalCode"`
-	Location              string  `json:"location"`
-	Altitude              string  `json:"altitude"`
-	TestStation           bool    `json:"testStation"`
-	LastCommunicationTime string  `json:"lastCommunicationTime"`
-	Landmark              string  `json:"landMark"`
-}
+// Station, ShortStation and BikesToReturn are shared with API clients through the model package
+type (
+	Station       = model.Station
+	ShortStation  = model.ShortStation
+	BikesToReturn = model.BikesToReturn
+)
 
-type ShortStation struct {
-	StationName    string `json:"stationName"`
-	Address        string `json:"address"`
-	AvailableDocks int    `json:"availableDocks"`
-	TotalDocks     int    `json:"totalDocks"`
-}
+const (
+	StatusOk    = model.StatusOk
+	StatusNotOk = model.StatusNotOk
+)
+
+// feedCacheKey The BigCache key holding the raw feed
+const feedCacheKey = "citibike-json"
+
+// errFeedUnavailable Neither a cached nor a fresh feed could be loaded
+var errFeedUnavailable = errors.New("could not load json")
 
-type BikesToReturn struct {
-	Dockable bool   `json:"dockable"`
-	Message  string `json:"message"`
+// errShuttingDown Ends long-lived streams once the server starts shutting down
+var errShuttingDown = errors.New("server is shutting down")
+
+// upstreamProblem The problem reported when the feed can't be loaded, a timeout if
+// the deadline of ctx passed first
+func upstreamProblem(ctx context.Context) *Problem {
+	if ctx.Err() == context.DeadlineExceeded {
+		return newProblem(http.StatusGatewayTimeout, problemUpstreamTimeout, "The CitiBike feed could not be loaded in time")
+	}
+	return newProblem(http.StatusBadGateway, problemUpstreamUnavailable, "The CitiBike feed could not be loaded")
 }
 
-const (
-	StatusOk    int = 1
-	StatusNotOk int = 3
-)
+// getJSON Loads the CitiBike feed from BigCache, falling back to the upstream API;
+// the request ID in ctx is forwarded upstream and attached to any errors
+func (S *Stations) getJSON(ctx context.Context) ([]Station, error) {
+	_, span := tracer.Start(ctx, "bigcache.Get")
+	body, err := App.Cache.Get(feedCacheKey)
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	span.End()
 
-// getJSON
-func (S *Stations) getJSON() []Station {
-	var body []byte
-	var err error
+	// Refetch once the snapshot is older than the refresh interval
+	age := feed.age()
+	stale := err == nil && age >= 0 && age >= currentConfig().Feed.RefreshInterval
 
-	cacheKey := "citibike-json"
-	body, err = App.Cache.Get(cacheKey)
+	if err != nil || stale {
+		fresh, fetchErr := fetchFeed(ctx)
 
-	if err != nil {
-		res, err := http.Get("https://www.citibikenyc.com/stations/json")
-		mantis.HandleError("getJSON:httpGet", err)
+		if fetchErr != nil {
+			handleRequestError(ctx, "getJSON:fetchFeed", fetchErr)
+
+			// We have neither something cached, nor fetchable data
+			if !stale {
+				handleRequestError(ctx, "getJSON:PostRead", errFeedUnavailable)
+				return nil, errFeedUnavailable
+			}
+		} else {
+			body = fresh
+			_, span = tracer.Start(ctx, "bigcache.Set")
+			err = App.Cache.Set(feedCacheKey, body)
+			endSpan(span, err)
+			handleRequestError(ctx, "getJSON:SetCache", err)
+		}
+	}
 
-		body, err = ioutil.ReadAll(res.Body)
-		mantis.HandleError("getJSON:ReadAll", err)
+	_, span = tracer.Start(ctx, "json.Unmarshal")
+	err = json.Unmarshal(body, &S)
+	endSpan(span, err)
+	if err != nil {
+		handleRequestError(ctx, "getJSON:JSONUnmarshal", err)
+		return nil, err
+	}
+	feed.setStations(len(S.StationBeanList))
+	observeStations(S.StationBeanList)
+	recordSnapshot(ctx, body)
 
-		err = App.Cache.Set(cacheKey, body)
-		mantis.HandleError("getJSON:SetCache", err)
+	return S.StationBeanList, nil
+}
 
-		// We have neither something cached, nor fetchable data, fail with empty list
+// fetchFeed Fetch the raw feed from upstream, recording latency, errors and size
+func fetchFeed(ctx context.Context) (body []byte, err error) {
+	feedURL := currentConfig().Feed.URL
+	ctx, span := tracer.Start(ctx, "upstream.fetch", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.url", feedURL)))
+	start := time.Now()
+	defer func() {
+		upstreamFetchDuration.Observe(time.Since(start).Seconds())
 		if err != nil {
-			mantis.HandleError("getJSON:PostRead", errors.New("could not load json"))
-			return S.StationBeanList
+			upstreamFetchErrors.Inc()
+			feed.failed(err)
 		}
+		span.SetAttributes(attribute.Int("http.response_content_length", len(body)))
+		endSpan(span, err)
+	}()
+
+	req, err := http.NewRequest("GET", feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if id := requestIDFromContext(ctx); id != "" {
+		req.Header.Set(requestIDHeader, id)
 	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
 
-	err = json.Unmarshal(body, &S)
-	mantis.HandleError("getJSON:JSONUnmarshal", err)
+	if logEnabled(levelDebug) {
+		logRequestMessage(ctx, "Fetching "+feedURL)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	span.SetAttributes(attribute.Int("http.status_code", res.StatusCode))
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("upstream responded %s", res.Status)
+	}
+
+	body, err = ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
 
-	return S.StationBeanList
+	upstreamFetchBytes.Add(float64(len(body)))
+	feed.succeeded()
+	return body, nil
 }
 
-// page
-func page(r *http.Request, response []ShortStation) []ShortStation {
-	responseLength := len(response)
-	perPage := 20
-
-	// Allow count per page
-	queryParam := mantis.GetQueryParameter(r, "perPage")
-	if queryParam != nil {
-		perPageOverride, err := strconv.Atoi(queryParam[0])
-		if err == nil && perPageOverride > 0 {
-			perPage = perPageOverride
+// stationFilter Reports whether a station belongs in a listing
+type stationFilter func(Station) bool
+
+// stationRenderer Converts a page of stations into the response body for an API version
+type stationRenderer func([]Station, Pagination) interface{}
+
+// listStations Loads the feed, keeps the stations matching the request's query, sorts
+// and pages them and writes them out using render. presets are query filters the
+// request can't override. When scores is set, only scored stations are listed, best
+// first unless the request sorts otherwise, with their scores
+func listStations(w http.ResponseWriter, r *http.Request, presets url.Values, scores stationScores, render stationRenderer) {
+	query, problem := parseStationQuery(r, presets)
+	if problem != nil {
+		HandleProblem(w, r, problem)
+		return
+	}
+
+	var stations Stations
+	stationList, err := stations.getJSON(r.Context())
+	if err != nil {
+		HandleProblem(w, r, upstreamProblem(r.Context()))
+		return
+	}
+
+	var scored map[int]float64
+	if scores != nil {
+		if scored = scores(r, stationList); scored == nil {
+			scored = map[int]float64{}
 		}
 	}
 
-	// Fetch our query param "page"
-	queryParam = mantis.GetQueryParameter(r, "page")
-	if queryParam == nil || responseLength <= perPage {
-		return response
+	matched, order := selectStations(stationList, query, scored)
+	stationPage, pagination, problem := paginate(w, r, matched, order)
+	if problem != nil {
+		HandleProblem(w, r, problem)
+		return
 	}
+	writeStations(w, r, stationPage, withScores(render(stationPage, pagination), stationPage, scored), query)
+}
 
-	// Convert our query "page?" value to an int
-	page, err := strconv.Atoi(queryParam[0])
-	if err != nil || page < 1 {
-		return response
+// selectStations The stations kept by query and the order to list them in. When
+// scored isn't nil only scored stations are kept, best first unless query sorts
+// otherwise
+func selectStations(stations []Station, query *stationQuery, scored map[int]float64) ([]Station, stationOrder) {
+	var matched = make([]Station, 0)
+	for _, station := range stations {
+		if _, ok := scored[station.Id]; (scored == nil || ok) && query.keep(station) {
+			matched = append(matched, station)
+		}
 	}
 
-	// set our min and max indexes
-	indexMin := 0
-	if page > 1 {
-		indexMin = (page - 1) * perPage
+	order := query.order
+	if scored != nil && !query.sorted {
+		order = stationOrder{key: func(station Station) []interface{} {
+			return []interface{}{scored[station.Id]}
+		}, descending: []bool{true}}
+	}
+	return matched, order
+}
+
+// stationScores Scores the stations relevant to a request, such as search results
+type stationScores func(r *http.Request, stations []Station) map[int]float64
+
+// withScores Set the score of each station in body, the rendering of stations
+func withScores(body interface{}, stations []Station, scored map[int]float64) interface{} {
+	if scored == nil {
+		return body
 	}
-	indexMax := indexMin + perPage
+	switch listing := body.(type) {
+	case []ShortStation:
+		for i := range listing {
+			listing[i].Score = scored[stations[i].Id]
+		}
+	case StationPage:
+		for i := range listing.Stations {
+			listing.Stations[i].Score = scored[stations[i].Id]
+		}
+	}
+	return body
+}
 
-	// handle a page greater than total available pages by setting to max
-	if page > (responseLength / perPage) {
-		indexMin = responseLength - perPage
-		indexMax = responseLength
+// writeStations Write stations, rendered as body, in the format negotiated for the
+// request and projected to the query's fields
+func writeStations(w http.ResponseWriter, r *http.Request, stations []Station, body interface{}, query *stationQuery) {
+	if problem := checkFields(body, query.fields); problem != nil {
+		HandleProblem(w, r, problem)
+		return
 	}
 
-	return response[indexMin:indexMax]
+	encoder, _ := formatEncoderNamed(listingEncoders, query.format)
+	var buffer bytes.Buffer
+	if err := encoder.encode(&buffer, &encodedListing{stations: stations, body: body, fields: query.fields}); err != nil {
+		HandleProblem(w, r, newProblem(http.StatusInternalServerError, problemBlank, err.Error()))
+		return
+	}
+
+	setSnapshotHeaders(w, r, encoder.Name)
+	w.Header().Set("Content-Type", encoder.ContentType)
+	w.Header().Set("X-App-Name", fmt.Sprintf("%s %s", App.Name, App.Version))
+	w.WriteHeader(http.StatusOK)
+	_, err := buffer.WriteTo(w)
+	handleRequestError(r.Context(), "writeStations", err)
 }
 
-// GetStations This method returns all the stations; query by paging supported
-func GetStations(w http.ResponseWriter, r *http.Request) {
-	var stations Stations
-	stations.getJSON()
+// Presets of the query engine for the in-service and not-in-service routes
+var (
+	inService    = url.Values{"status": {"in-service"}}
+	notInService = url.Values{"status": {"not-in-service"}}
+)
 
-	var response = make([]ShortStation, 0)
-	for _, station := range stations.StationBeanList {
+// toShortStations Renders stations in the v1 ShortStation shape
+func toShortStations(stations []Station) []ShortStation {
+	var response = make([]ShortStation, 0, len(stations))
+	for _, station := range stations {
 		response = append(response, ShortStation{
 			StationName: station.StationName,
 			Address: strings.TrimSpace(fmt.Sprintf("%s %s %s %s", station.Address1,
@@ -142,139 +274,156 @@ func GetStations(w http.ResponseWriter, r *http.Request) {
 			TotalDocks:     station.TotalDocks,
 		})
 	}
+	return response
+}
+
+// shortStationListing Renders a v1 listing. v1 has always returned a bare array of
+// ShortStations, so its paging is only described by the X-Total-Count and Link headers
+func shortStationListing(stations []Station, _ Pagination) interface{} {
+	return toShortStations(stations)
+}
 
-	response = page(r, response)
-	HandleResponse(w, response, http.StatusOK)
+// GetStations This method returns all the stations; query by paging supported
+func GetStations(w http.ResponseWriter, r *http.Request) {
+	listStations(w, r, nil, nil, shortStationListing)
 }
 
 // GetStationsInService
 func GetStationsInService(w http.ResponseWriter, r *http.Request) {
-	var stations Stations
-	stations.getJSON()
-
-	var response = make([]ShortStation, 0)
-	for _, station := range stations.StationBeanList {
-		if station.StatusKey == StatusOk {
-			response = append(response, ShortStation{
-				StationName: station.StationName,
-				Address: strings.TrimSpace(fmt.Sprintf("%s %s %s %s", station.Address1,
-					station.Address2, station.City, station.PostalCode)),
-				AvailableDocks: station.AvailableDocks,
-				TotalDocks:     station.TotalDocks,
-			})
-		}
-	}
-
-	response = page(r, response)
-	HandleResponse(w, response, http.StatusOK)
+	listStations(w, r, inService, nil, shortStationListing)
 }
 
 // GetStationsNotInService
 func GetStationsNotInService(w http.ResponseWriter, r *http.Request) {
-	var stations Stations
-	stations.getJSON()
-
-	var response = make([]ShortStation, 0)
-	for _, station := range stations.StationBeanList {
-		if station.StatusKey == StatusNotOk {
-			response = append(response, ShortStation{
-				StationName: station.StationName,
-				Address: strings.TrimSpace(fmt.Sprintf("%s %s %s %s", station.Address1,
-					station.Address2, station.City, station.PostalCode)),
-				AvailableDocks: station.AvailableDocks,
-				TotalDocks:     station.TotalDocks,
-			})
-		}
-	}
-
-	response = page(r, response)
-	HandleResponse(w, response, http.StatusOK)
+	listStations(w, r, notInService, nil, shortStationListing)
 }
 
-// GetStationsMatchingString
+// GetStationsMatchingString Searches station names and addresses, tolerating typos
+// and abbreviations, best match first
 func GetStationsMatchingString(w http.ResponseWriter, r *http.Request) {
-	var stations Stations
-	stations.getJSON()
-
-	var response = make([]ShortStation, 0)
-
-	// get our search string in /stations/:search, if empty return empty response
-	searchString := mantis.GetUrlParameter(r, "search")
-	if len(searchString) < 1 {
-		HandleResponse(w, response, http.StatusOK)
-		return
-	}
-	searchString = strings.TrimSpace(strings.ToLower(searchString))
-
-	for _, station := range stations.StationBeanList {
-		var key = strings.ToLower(fmt.Sprintf("%s %s %s", station.StationName, station.Address1, station.Address2))
-
-		if strings.Contains(key, searchString) {
-			response = append(response, ShortStation{
-				StationName: station.StationName,
-				Address: strings.TrimSpace(fmt.Sprintf("%s %s %s %s", station.Address1,
-					station.Address2, station.City, station.PostalCode)),
-				AvailableDocks: station.AvailableDocks,
-				TotalDocks:     station.TotalDocks,
-			})
-		}
-	}
-
-	response = page(r, response)
-	HandleResponse(w, response, http.StatusOK)
+	listStations(w, r, nil, searchScores, shortStationListing)
 }
 
-// GetIsBikeDockable
+// GetIsBikeDockable Reports whether bikesToReturn bikes can be docked at stationId. A
+// station that can't take them is a normal answer, not an error
 func GetIsBikeDockable(w http.ResponseWriter, r *http.Request) {
-	var stations Stations
-	stations.getJSON()
-
-	var response BikesToReturn
-	var errorOutputs = make(map[string]string)
-
 	sid := mantis.GetUrlParameter(r, "stationId")
 	stationId, err := strconv.Atoi(sid)
 	if err != nil {
-		mantis.HandleError("GetIsBikeDockable:stationId", err)
-		errorOutputs["error"] = "Missing or invalid station id"
-		HandleResponse(w, errorOutputs, http.StatusBadRequest)
+		handleRequestError(r.Context(), "GetIsBikeDockable:stationId", err)
+		HandleProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "Missing or invalid station id"))
 		return
 	}
 
 	btr := mantis.GetUrlParameter(r, "bikesToReturn")
 	bikesToReturn, err := strconv.Atoi(btr)
+	if err != nil || bikesToReturn < 0 {
+		handleRequestError(r.Context(), "GetIsBikeDockable:bikesToReturn", err)
+		HandleProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "Missing or invalid num bikes to return"))
+		return
+	}
+
+	var stations Stations
+	stationList, err := stations.getJSON(r.Context())
 	if err != nil {
-		mantis.HandleError("GetIsBikeDockable:bikesToReturn", err)
-		errorOutputs["error"] = "Missing or invalid num bikes to return"
-		HandleResponse(w, errorOutputs, http.StatusBadRequest)
+		HandleProblem(w, r, upstreamProblem(r.Context()))
+		return
+	}
+
+	station, ok := findStation(stationList, stationId)
+	if !ok {
+		HandleProblem(w, r, stationNotFound(stationId))
 		return
 	}
+	writeDocument(w, r, dockability(station, bikesToReturn), http.StatusOK)
+}
+
+// findStation The station with id
+func findStation(stations []Station, id int) (Station, bool) {
+	for _, station := range stations {
+		if station.Id == id {
+			return station, true
+		}
+	}
+	return Station{}, false
+}
 
-	response.Message = "No docks available"
-	response.Dockable = false
-	status := http.StatusBadRequest
-
-	for _, station := range stations.StationBeanList {
-		if station.Id == stationId && station.AvailableDocks > 0 {
-			if bikesToReturn-station.AvailableDocks > 0 {
-				response.Dockable = false
-				response.Message = fmt.Sprintf("Docks are available for %d docks, you are requesting return of %d bikes", station.AvailableDocks, bikesToReturn)
-				status = http.StatusBadRequest
-				break
+// stationNotFound The problem reported for an unknown station id
+func stationNotFound(id int) *Problem {
+	return newProblem(http.StatusNotFound, problemStationNotFound, fmt.Sprintf("No station with id %d", id))
+}
+
+// dockability Whether bikesToReturn bikes can be docked at station
+func dockability(station Station, bikesToReturn int) BikesToReturn {
+	var response BikesToReturn
+	switch {
+	case station.AvailableDocks < 1:
+		response.Message = "No docks available"
+	case bikesToReturn-station.AvailableDocks > 0:
+		response.Message = fmt.Sprintf("Docks are available for %d docks, you are requesting return of %d bikes", station.AvailableDocks, bikesToReturn)
+	case station.StatusKey == StatusNotOk:
+		response.Message = "Docks are available, but station is out of service"
+	default:
+		response.Dockable = true
+		response.Message = "Docks available"
+	}
+	return response
+}
+
+// StationUpdate A station that was added or changed, or that has been removed from the
+// feed or no longer matches a watch's filters
+type StationUpdate struct {
+	Station StationDetail `json:"station"`
+	Removed bool          `json:"removed"`
+}
+
+// watchStations Calls send with every station kept by query, then checks the snapshot
+// every interval and calls send with each station that changed, appeared or went away.
+// Returns nil once ctx is done, errShuttingDown once the server starts shutting down
+// and errFeedUnavailable if the first snapshot can't be loaded; later upstream failures
+// are waited out
+func watchStations(ctx context.Context, query *stationQuery, interval func() time.Duration, send func(StationUpdate) error) error {
+	sent := make(map[int]StationDetail)
+	for first := true; ; first = false {
+		var stations Stations
+		stationList, err := stations.getJSON(ctx)
+		if err != nil && first {
+			return errFeedUnavailable
+		}
+		if err == nil {
+			matched, _ := selectStations(stationList, query, nil)
+			current := make(map[int]StationDetail, len(matched))
+			for _, detail := range toStationDetails(sortStations(matched, stationOrder{})) {
+				current[detail.ID] = detail
+				if previous, ok := sent[detail.ID]; ok && previous == detail {
+					continue
+				}
+				if err := send(StationUpdate{Station: detail}); err != nil {
+					return err
+				}
 			}
 
-			if station.StatusKey == StatusNotOk {
-				response.Dockable = false
-				response.Message = "Docks are available, but station is out of service"
-				status = http.StatusBadRequest
-				break
+			var removed []int
+			for id := range sent {
+				if _, ok := current[id]; !ok {
+					removed = append(removed, id)
+				}
+			}
+			sort.Ints(removed)
+			for _, id := range removed {
+				if err := send(StationUpdate{Station: sent[id], Removed: true}); err != nil {
+					return err
+				}
 			}
-			response.Dockable = true
-			response.Message = "Docks available"
-			status = http.StatusOK
-			break
+			sent = current
 		}
-	}
 
-	HandleResponse(w, response, status)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-background.Done():
+			return errShuttingDown
+		case <-time.After(interval()):
+		}
+	}
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/sphireco/mantis"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// tlsVersions The accepted values of TLS_MIN_VERSION
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certificates The HTTP server's certificate and client CAs, loaded from the files
+// in a TLSConfig and swapped atomically when they are reloaded
+type certificates struct {
+	cfg     TLSConfig
+	current atomic.Value
+}
+
+// loadCertificates Read the certificate, key and client CA named in cfg
+func loadCertificates(cfg TLSConfig) (*certificates, error) {
+	certs := &certificates{cfg: cfg}
+	if err := certs.reload(); err != nil {
+		return nil, err
+	}
+	return certs, nil
+}
+
+// reload Re-read the files, keeping the certificates in use if any can't be loaded
+func (c *certificates) reload() error {
+	certificate, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tlsVersions[c.cfg.MinVersion],
+		Certificates: []tls.Certificate{certificate},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if c.cfg.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no certificates found", c.cfg.ClientCAFile)
+		}
+		// Only adminOnly routes insist on a certificate
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	c.current.Store(config)
+	return nil
+}
+
+// serverConfig The http.Server TLS configuration, handing each connection whichever
+// certificates are current. HTTP/2 is negotiated with ALPN
+func (c *certificates) serverConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tlsVersions[c.cfg.MinVersion],
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.current.Load().(*tls.Config), nil
+		},
+	}
+}
+
+// watchCertificates Reload certs whenever one of its files changes, until ctx is done.
+// As with watchConfig, directories are watched so that files replaced by renames,
+// as cert-manager and Kubernetes secrets do, are picked up
+func watchCertificates(ctx context.Context, certs *certificates) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		mantis.HandleError("watchCertificates:NewWatcher", err)
+		return
+	}
+	defer watcher.Close()
+
+	dirs := make(map[string]bool)
+	for _, file := range []string{certs.cfg.CertFile, certs.cfg.KeyFile, certs.cfg.ClientCAFile} {
+		if file == "" {
+			continue
+		}
+		path, err := filepath.Abs(file)
+		if err != nil {
+			mantis.HandleError("watchCertificates:Abs", err)
+			continue
+		}
+		if dir := filepath.Dir(path); !dirs[dir] {
+			dirs[dir] = true
+			mantis.HandleError("watchCertificates:Add", watcher.Add(dir))
+		}
+	}
+
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-watcher.Events:
+			pending = time.After(500 * time.Millisecond)
+		case err := <-watcher.Errors:
+			mantis.HandleError("watchCertificates", err)
+		case <-pending:
+			pending = nil
+			if err := certs.reload(); err != nil {
+				Logger.Write(fmt.Sprintf("TLS certificate reload failed, keeping the current certificate: %s", err))
+				continue
+			}
+			Logger.Write("TLS certificates reloaded")
+		}
+	}
+}
+
+// httpsRedirect Redirects every request to the same URL over HTTPS on port. 308 keeps
+// the method and body, so POSTs to /graphql are redirected too
+func httpsRedirect(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// newRedirectServer The plain HTTP server redirecting to HTTPS, if TLS_REDIRECT_PORT is set
+func newRedirectServer(cfg *Config) *http.Server {
+	if !cfg.TLS.enabled() || cfg.TLS.RedirectPort == "" {
+		return nil
+	}
+	return &http.Server{
+		Addr:         net.JoinHostPort(cfg.Server.Address, cfg.TLS.RedirectPort),
+		Handler:      httpsRedirect(cfg.Server.Port),
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+	}
+}
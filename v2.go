@@ -0,0 +1,164 @@
+package main
+
+import (
+	"github.com/jsanc623/NBC/model"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// The v2 station types are shared with API clients through the model package
+type (
+	StationDetail   = model.StationDetail
+	StationAddress  = model.StationAddress
+	StationLocation = model.StationLocation
+	StationStatus   = model.StationStatus
+	StationPage     = model.StationPage
+)
+
+// toStationDetails Converts stations to the v2 StationDetail shape
+func toStationDetails(stations []Station) []StationDetail {
+	var response = make([]StationDetail, 0, len(stations))
+	for _, station := range stations {
+		response = append(response, StationDetail{
+			ID:   station.Id,
+			Name: station.StationName,
+			Address: StationAddress{
+				Street1:    station.Address1,
+				Street2:    station.Address2,
+				City:       station.City,
+				PostalCode: station.PostalCode,
+				Landmark:   station.Landmark,
+			},
+			Location: StationLocation{
+				Latitude:  station.Latitude,
+				Longitude: station.Longitude,
+				Altitude:  station.Altitude,
+			},
+			Status: StationStatus{
+				Key:       station.StatusKey,
+				Value:     station.StatusValue,
+				InService: station.StatusKey == StatusOk,
+			},
+			AvailableBikes:        station.AvailableBikes,
+			AvailableDocks:        station.AvailableDocks,
+			TotalDocks:            station.TotalDocks,
+			TestStation:           station.TestStation,
+			LastCommunicationTime: station.LastCommunicationTime,
+		})
+	}
+	return response
+}
+
+// toStationPage Renders stations as a v2 StationPage
+func toStationPage(stations []Station, pagination Pagination) interface{} {
+	return StationPage{Stations: toStationDetails(stations), Pagination: pagination}
+}
+
+// GetStationsV2 Returns all stations in the v2 shape; query by paging supported
+func GetStationsV2(w http.ResponseWriter, r *http.Request) {
+	listStations(w, r, nil, nil, toStationPage)
+}
+
+// GetStationsInServiceV2 Returns stations that are in service in the v2 shape
+func GetStationsInServiceV2(w http.ResponseWriter, r *http.Request) {
+	listStations(w, r, inService, nil, toStationPage)
+}
+
+// GetStationsNotInServiceV2 Returns stations that are not in service in the v2 shape
+func GetStationsNotInServiceV2(w http.ResponseWriter, r *http.Request) {
+	listStations(w, r, notInService, nil, toStationPage)
+}
+
+// GetStationsMatchingStringV2 Searches stations by name or address, returning the v2 shape
+// with relevance scores
+func GetStationsMatchingStringV2(w http.ResponseWriter, r *http.Request) {
+	listStations(w, r, nil, searchScores, toStationPage)
+}
+
+// earthRadius The mean radius of the earth in meters
+const earthRadius = 6371000.0
+
+// distance The great-circle distance in meters between two points, by the haversine formula
+func distance(lat1, lon1, lat2, lon2 float64) float64 {
+	toRadians := math.Pi / 180
+	dLat := (lat2 - lat1) * toRadians
+	dLon := (lon2 - lon1) * toRadians
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*toRadians)*math.Cos(lat2*toRadians)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// GetStationsNearV2 Returns stations within ?radius meters (default 500) of ?lat and ?lon,
+// nearest first, in the v2 shape with their distance; query by paging, filters and
+// sort supported
+func GetStationsNearV2(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	lat, err := strconv.ParseFloat(query.Get("lat"), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		HandleProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "Missing or invalid lat"))
+		return
+	}
+	lon, err := strconv.ParseFloat(query.Get("lon"), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		HandleProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "Missing or invalid lon"))
+		return
+	}
+	radius := 500.0
+	if query.Get("radius") != "" {
+		radius, err = strconv.ParseFloat(query.Get("radius"), 64)
+		if err != nil || radius <= 0 {
+			HandleProblem(w, r, newProblem(http.StatusBadRequest, problemInvalidParameter, "Invalid radius"))
+			return
+		}
+	}
+
+	stationQuery, problem := parseStationQuery(r, nil, "lat", "lon", "radius")
+	if problem != nil {
+		HandleProblem(w, r, problem)
+		return
+	}
+
+	var stations Stations
+	stationList, err := stations.getJSON(r.Context())
+	if err != nil {
+		HandleProblem(w, r, upstreamProblem(r.Context()))
+		return
+	}
+
+	near, order, distances := stationsNear(stationList, lat, lon, radius, stationQuery)
+	stationPage, pagination, problem := paginate(w, r, near, order)
+	if problem != nil {
+		HandleProblem(w, r, problem)
+		return
+	}
+
+	response := StationPage{Stations: toStationDetails(stationPage), Pagination: pagination}
+	for i := range response.Stations {
+		response.Stations[i].Distance = math.Round(distances[response.Stations[i].ID])
+	}
+	writeStations(w, r, stationPage, response, stationQuery)
+}
+
+// stationsNear The stations kept by query within radius meters of lat, lon, the order
+// to list them in, nearest first unless query sorts otherwise, and their distances
+func stationsNear(stations []Station, lat, lon, radius float64, query *stationQuery) ([]Station, stationOrder, map[int]float64) {
+	var near = make([]Station, 0)
+	distances := make(map[int]float64)
+	for _, station := range stations {
+		d := distance(lat, lon, station.Latitude, station.Longitude)
+		if d <= radius && query.keep(station) {
+			near = append(near, station)
+			distances[station.Id] = d
+		}
+	}
+
+	order := query.order
+	if !query.sorted {
+		order.key = func(station Station) []interface{} {
+			return []interface{}{distances[station.Id]}
+		}
+	}
+	return near, order, distances
+}